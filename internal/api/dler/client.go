@@ -21,11 +21,18 @@ package dler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/log"
 )
 
 // NewClient 返回 Dler Cloud API 客户端.
@@ -38,41 +45,100 @@ type Client struct {
 	email    string
 	password string
 
-	token string
+	mu             sync.RWMutex
+	token          string
+	onTokenChanged func(token string)
+}
+
+// Token 返回当前的 access_token.
+func (c *Client) Token() string {
+	return c.getToken()
+}
+
+// SetToken 使用已有的 access_token, 例如从持久化状态中恢复.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// OnTokenChanged 设置登录获得新 token 后的回调.
+func (c *Client) OnTokenChanged(fn func(token string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onTokenChanged = fn
 }
 
 // HasLoggedIn 返回是否已登录.
 func (c *Client) HasLoggedIn() bool {
-	return len(c.token) > 0
+	return len(c.getToken()) > 0
+}
+
+func (c *Client) getToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
 }
 
 // Login 登录.
 func (c *Client) Login(ctx context.Context) error {
+	c.mu.Lock()
+	notify, err := c.login(ctx)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	notify()
+	return nil
+}
+
+// login 登录并更新 token, 调用方需持有写锁.
+// 返回的函数调用 token 更新的回调, 需在释放锁之后调用, 避免回调阻塞其他请求.
+func (c *Client) login(ctx context.Context) (notify func(), err error) {
 	var response = new(struct {
 		Token string `json:"token"`
 	})
-	err := c.post(ctx, "login", map[string]interface{}{
+	err = c.post(ctx, "login", map[string]interface{}{
 		"email":  c.email,
 		"passwd": c.password,
 	}, response)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c.token = response.Token
+	fn, token := c.onTokenChanged, c.token
+	return func() {
+		if fn != nil {
+			fn(token)
+		}
+	}, nil
+}
+
+// relogin 在 token 失效后重新登录. 若其他请求已经刷新了 token 则直接返回.
+func (c *Client) relogin(ctx context.Context, expiredToken string) error {
+	c.mu.Lock()
+	if c.token != expiredToken {
+		c.mu.Unlock()
+		return nil
+	}
+	notify, err := c.login(ctx)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	notify()
 	return nil
 }
 
 // GetUserInfo 获取用户信息.
 func (c *Client) GetUserInfo(ctx context.Context) (*UserInfo, error) {
-	if !c.HasLoggedIn() {
-		return nil, fmt.Errorf("not logged in")
-	}
-
 	var response = new(UserInfo)
-	err := c.post(ctx, "information", map[string]interface{}{
-		"access_token": c.token,
-	}, response)
+	err := c.postWithToken(ctx, "information", nil, response)
 	if err != nil {
 		return nil, err
 	}
@@ -82,15 +148,184 @@ func (c *Client) GetUserInfo(ctx context.Context) (*UserInfo, error) {
 
 // UserInfo 用户信息.
 type UserInfo struct {
-	Plan      string `json:"plan"`
-	PlanTime  string `json:"plan_time"`
-	Money     string `json:"money"`
-	AffMoney  string `json:"aff_money"`
-	TodayUsed string `json:"today_used"`
-	Used      string `json:"used"`
-	Unused    string `json:"unused"`
-	Traffic   string `json:"traffic"`
-	Integral  string `json:"integral"`
+	Plan      string        `json:"plan"`
+	PlanTime  string        `json:"plan_time"`
+	Money     string        `json:"money"`
+	AffMoney  string        `json:"aff_money"`
+	TodayUsed bytesize.Size `json:"today_used"`
+	Used      bytesize.Size `json:"used"`
+	Unused    bytesize.Size `json:"unused"`
+	Traffic   bytesize.Size `json:"traffic"`
+	Integral  string        `json:"integral"`
+
+	present map[string]bool // 响应中包含的流量字段
+}
+
+// Has 返回响应中是否包含名为 name 的流量字段, 例如 "used". 不包含的字段值为 0.
+func (u *UserInfo) Has(name string) bool {
+	return u.present[name]
+}
+
+// UnmarshalJSON 解析用户信息. 流量字段无法识别时记录日志并视为 0, 不影响其他字段.
+func (u *UserInfo) UnmarshalJSON(data []byte) error {
+	type plain UserInfo
+	var v struct {
+		*plain
+		TodayUsed json.RawMessage `json:"today_used"`
+		Used      json.RawMessage `json:"used"`
+		Unused    json.RawMessage `json:"unused"`
+		Traffic   json.RawMessage `json:"traffic"`
+	}
+	v.plain = (*plain)(u)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	u.present = make(map[string]bool)
+	for name, raw := range map[string]json.RawMessage{
+		"today_used": v.TodayUsed,
+		"used":       v.Used,
+		"unused":     v.Unused,
+		"traffic":    v.Traffic,
+	} {
+		u.present[name] = len(raw) > 0 && string(raw) != "null"
+	}
+	u.TodayUsed = lenientSize("today_used", v.TodayUsed)
+	u.Used = lenientSize("used", v.Used)
+	u.Unused = lenientSize("unused", v.Unused)
+	u.Traffic = lenientSize("traffic", v.Traffic)
+	return nil
+}
+
+// PlanExpiry 返回套餐到期时间. PlanTime 为空或无法识别时 ok 为 false.
+func (u *UserInfo) PlanExpiry(loc *time.Location) (expiry time.Time, ok bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, u.PlanTime, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Checkin 签到. 今日已签到时返回 ErrAlreadyCheckedIn.
+func (c *Client) Checkin(ctx context.Context) (*CheckinResult, error) {
+	var response = new(CheckinResult)
+	err := c.postWithToken(ctx, "checkin", nil, response)
+	if err != nil {
+		var resultErr *ResultError
+		if errors.As(err, &resultErr) && isAlreadyCheckedIn(resultErr.Message) {
+			return nil, ErrAlreadyCheckedIn
+		}
+		return nil, err
+	}
+
+	if match := checkinTrafficRegexp.FindString(response.Message); len(match) > 0 {
+		if traffic, err := bytesize.Parse(match, bytesize.Binary); err == nil {
+			response.Traffic = traffic
+		}
+	}
+	return response, nil
+}
+
+// CheckinResult 签到结果.
+type CheckinResult struct {
+	Message string        `json:"checkin"`
+	Traffic bytesize.Size `json:"-"` // 签到获得的流量, 从 Message 中解析
+
+	TodayUsed    bytesize.Size `json:"today_used"`
+	Used         bytesize.Size `json:"used"`
+	Unused       bytesize.Size `json:"unused"`
+	TotalTraffic bytesize.Size `json:"traffic"`
+}
+
+// UnmarshalJSON 解析签到结果. 流量字段无法识别时记录日志并视为 0, 不影响其他字段.
+func (r *CheckinResult) UnmarshalJSON(data []byte) error {
+	type plain CheckinResult
+	var v struct {
+		*plain
+		TodayUsed    json.RawMessage `json:"today_used"`
+		Used         json.RawMessage `json:"used"`
+		Unused       json.RawMessage `json:"unused"`
+		TotalTraffic json.RawMessage `json:"traffic"`
+	}
+	v.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.TodayUsed = lenientSize("today_used", v.TodayUsed)
+	r.Used = lenientSize("used", v.Used)
+	r.Unused = lenientSize("unused", v.Unused)
+	r.TotalTraffic = lenientSize("traffic", v.TotalTraffic)
+	return nil
+}
+
+// lenientSize 解析流量字段, 缺失或无法识别时返回 0.
+func lenientSize(name string, raw json.RawMessage) bytesize.Size {
+	if len(raw) <= 0 {
+		return 0
+	}
+	var size bytesize.Size
+	if err := json.Unmarshal(raw, &size); err != nil {
+		log.Errorf("failed to parse %s %s from Dler Cloud, use 0 instead, error: %+v", name, raw, err)
+		return 0
+	}
+	return size
+}
+
+// ErrAlreadyCheckedIn 今日已签到.
+var ErrAlreadyCheckedIn = errors.New("already checked in today")
+
+var checkinTrafficRegexp = regexp.MustCompile(`\d+(\.\d+)?\s*[KMGTP]?B`)
+
+func isAlreadyCheckedIn(msg string) bool {
+	return strings.Contains(msg, "已签到") || strings.Contains(msg, "签到过")
+}
+
+// GetSubscription 获取托管订阅链接.
+func (c *Client) GetSubscription(ctx context.Context) (*Subscription, error) {
+	var response = new(Subscription)
+	err := c.postWithToken(ctx, "managed/clash", nil, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Subscription 托管订阅链接.
+type Subscription struct {
+	Name   string `json:"name"`
+	Smart  string `json:"smart"`
+	SS     string `json:"ss"`
+	SS2022 string `json:"ss2022"`
+	VMess  string `json:"vmess"`
+	Trojan string `json:"trojan"`
+}
+
+// Links 按固定顺序返回所有非空的订阅链接.
+func (s *Subscription) Links() []SubscriptionLink {
+	all := []SubscriptionLink{
+		{Protocol: "smart", URL: s.Smart},
+		{Protocol: "ss", URL: s.SS},
+		{Protocol: "ss2022", URL: s.SS2022},
+		{Protocol: "vmess", URL: s.VMess},
+		{Protocol: "trojan", URL: s.Trojan},
+	}
+
+	ret := make([]SubscriptionLink, 0, len(all))
+	for _, link := range all {
+		if len(link.URL) > 0 {
+			ret = append(ret, link)
+		}
+	}
+	return ret
+}
+
+// SubscriptionLink 单个协议的订阅链接.
+type SubscriptionLink struct {
+	Protocol string
+	URL      string
 }
 
 func (c *Client) getURL(path string) string {
@@ -98,6 +333,36 @@ func (c *Client) getURL(path string) string {
 	return fmt.Sprintf(urlFmt, path)
 }
 
+// postWithToken 携带 access_token 发起请求. 尚未登录时先登录; 若 token 已失效, 会自动重新登录并重试一次.
+func (c *Client) postWithToken(ctx context.Context, path string, body map[string]interface{}, dest interface{}) error {
+	token := c.getToken()
+	if len(token) <= 0 {
+		if err := c.relogin(ctx, token); err != nil {
+			return fmt.Errorf("failed to log in: %+v", err)
+		}
+		token = c.getToken()
+	}
+
+	err := c.post(ctx, path, withToken(body, token), dest)
+	if !isTokenInvalid(err) {
+		return err
+	}
+
+	if err := c.relogin(ctx, token); err != nil {
+		return fmt.Errorf("failed to re-login after token expired: %+v", err)
+	}
+	return c.post(ctx, path, withToken(body, c.getToken()), dest)
+}
+
+func withToken(body map[string]interface{}, token string) map[string]interface{} {
+	ret := make(map[string]interface{}, len(body)+1)
+	for k, v := range body {
+		ret[k] = v
+	}
+	ret["access_token"] = token
+	return ret
+}
+
 func (c *Client) post(ctx context.Context, path string, body map[string]interface{}, dest interface{}) error {
 	var (
 		httpReq *http.Request
@@ -143,7 +408,7 @@ func (c *Client) post(ctx context.Context, path string, body map[string]interfac
 		return fmt.Errorf("failed to unmarshal response body: %+v", err)
 	}
 	if resp.Code != http.StatusOK {
-		return fmt.Errorf("invalid result code %d with message: %s", resp.Code, resp.Message)
+		return &ResultError{Code: resp.Code, Message: resp.Message}
 	}
 
 	if dest == nil {
@@ -160,3 +425,27 @@ type response struct {
 	Message string          `json:"msg"`
 	Data    json.RawMessage `json:"data"`
 }
+
+// ResultError 接口返回的非成功结果.
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("invalid result code %d with message: %s", e.Code, e.Message)
+}
+
+// tokenInvalidCodes 表示 access_token 无效或已过期的结果码.
+var tokenInvalidCodes = map[int]bool{
+	http.StatusUnauthorized: true,
+	http.StatusForbidden:    true,
+}
+
+func isTokenInvalid(err error) bool {
+	var resultErr *ResultError
+	if !errors.As(err, &resultErr) {
+		return false
+	}
+	return tokenInvalidCodes[resultErr.Code]
+}
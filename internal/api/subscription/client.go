@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+// DefaultUserAgent 默认的 User-Agent. 部分机场只对代理客户端返回 subscription-userinfo.
+const DefaultUserAgent = "ClashForWindows/0.20.0"
+
+// 关闭响应前最多丢弃的内容长度.
+const maxDiscardBytes = 64 * 1024
+
+// NewClient 返回订阅链接客户端.
+func NewClient(userAgent string) *Client {
+	if len(userAgent) <= 0 {
+		userAgent = DefaultUserAgent
+	}
+	return &Client{userAgent: userAgent}
+}
+
+// Client 订阅链接客户端.
+type Client struct {
+	userAgent string
+}
+
+// GetUserinfo 查询订阅链接的 subscription-userinfo 响应头.
+// 先尝试 HEAD 请求, 若响应中没有该响应头再使用 GET 请求.
+func (c *Client) GetUserinfo(ctx context.Context, subURL string) (*Userinfo, error) {
+	header, err := c.do(ctx, http.MethodHead, subURL)
+	if err != nil || len(header) <= 0 {
+		header, err = c.do(ctx, http.MethodGet, subURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) <= 0 {
+		return nil, fmt.Errorf("subscription-userinfo header not found")
+	}
+
+	return ParseUserinfo(header)
+}
+
+func (c *Client) do(ctx context.Context, method string, subURL string) (string, error) {
+	httpReq, err := http.NewRequest(method, subURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %+v", redactURL(err))
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	httpReq = httpReq.WithContext(ctx)
+
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to do request: %+v", redactURL(err))
+	}
+	defer httpResp.Body.Close()
+	// 只需要响应头, 丢弃订阅内容. 只读取少量内容以便复用连接, 不读取完整的订阅
+	io.Copy(ioutil.Discard, io.LimitReader(httpResp.Body, maxDiscardBytes))
+
+	if httpResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("invalid response status code: %d", httpResp.StatusCode)
+	}
+	return httpResp.Header.Get("Subscription-Userinfo"), nil
+}
+
+// redactURL 去掉错误中的订阅链接. 订阅链接包含密钥, 不能出现在日志和回复中.
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
+
+// Userinfo subscription-userinfo 响应头中的流量信息.
+type Userinfo struct {
+	Upload   bytesize.Size
+	Download bytesize.Size
+	Total    bytesize.Size
+	Expire   time.Time // 零值表示不过期
+}
+
+// Used 返回已用流量.
+func (u *Userinfo) Used() bytesize.Size {
+	return u.Upload + u.Download
+}
+
+// ParseUserinfo 解析 "upload=1; download=2; total=3; expire=1700000000" 格式的响应头.
+func ParseUserinfo(header string) (*Userinfo, error) {
+	info := new(Userinfo)
+	for _, part := range strings.Split(header, ";") {
+		part = strings.TrimSpace(part)
+		if len(part) <= 0 {
+			continue
+		}
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid subscription-userinfo %q", header)
+		}
+		key, value := strings.ToLower(strings.TrimSpace(part[:i])), strings.TrimSpace(part[i+1:])
+		if len(value) <= 0 {
+			continue
+		}
+
+		// 部分机场返回浮点数
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in subscription-userinfo %q", key, header)
+		}
+		switch key {
+		case "upload":
+			info.Upload = bytesize.Size(n)
+		case "download":
+			info.Download = bytesize.Size(n)
+		case "total":
+			info.Total = bytesize.Size(n)
+		case "expire":
+			if n > 0 {
+				info.Expire = time.Unix(int64(n), 0)
+			}
+		}
+	}
+	return info, nil
+}
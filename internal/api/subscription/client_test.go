@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+func TestParseUserinfo(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    Userinfo
+		wantErr bool
+	}{
+		{
+			header: "upload=1024; download=2048; total=10737418240; expire=1700000000",
+			want:   Userinfo{Upload: 1024, Download: 2048, Total: 10 * bytesize.GiB, Expire: time.Unix(1700000000, 0)},
+		},
+
+		// 空格和大小写
+		{
+			header: "  Upload = 1 ;download=2;TOTAL=3 ",
+			want:   Userinfo{Upload: 1, Download: 2, Total: 3},
+		},
+
+		// 缺少的字段和空值
+		{
+			header: "download=2048",
+			want:   Userinfo{Download: 2048},
+		},
+		{
+			header: "upload=; download=2; total=3; expire=",
+			want:   Userinfo{Download: 2, Total: 3},
+		},
+		{
+			header: "upload=1;;download=2;",
+			want:   Userinfo{Upload: 1, Download: 2},
+		},
+		{
+			header: "",
+			want:   Userinfo{},
+		},
+
+		// expire 为 0 表示不过期
+		{
+			header: "upload=1; download=2; total=3; expire=0",
+			want:   Userinfo{Upload: 1, Download: 2, Total: 3},
+		},
+
+		// 浮点数和未知字段
+		{
+			header: "upload=1.5e3; download=20.0; total=3; foo=4",
+			want:   Userinfo{Upload: 1500, Download: 20, Total: 3},
+		},
+
+		// 错误的格式
+		{header: "upload", wantErr: true},
+		{header: "upload=1; download", wantErr: true},
+		{header: "upload=abc", wantErr: true},
+		{header: "total=1GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUserinfo(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseUserinfo(%q) = %+v, want error", tt.header, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUserinfo(%q) error: %v", tt.header, err)
+			continue
+		}
+		if got.Upload != tt.want.Upload || got.Download != tt.want.Download || got.Total != tt.want.Total || !got.Expire.Equal(tt.want.Expire) {
+			t.Errorf("ParseUserinfo(%q) = %+v, want %+v", tt.header, *got, tt.want)
+		}
+	}
+}
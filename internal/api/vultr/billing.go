@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package vultr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GetAccount 查询账户信息.
+func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
+	var response struct {
+		Account *Account `json:"account"`
+	}
+
+	if err := c.get(ctx, "account", &response); err != nil {
+		return nil, err
+	}
+	if response.Account == nil {
+		return nil, fmt.Errorf("account is missing in response")
+	}
+
+	return response.Account, nil
+}
+
+// Account 账户信息. 金额单位为美元.
+type Account struct {
+	Name              string  `json:"name"`
+	Email             string  `json:"email"`
+	Balance           float64 `json:"balance"` // 为负数时表示账户中的余额, 为正数时表示欠款
+	PendingCharges    float64 `json:"pending_charges"`
+	LastPaymentDate   Date    `json:"last_payment_date"`
+	LastPaymentAmount float64 `json:"last_payment_amount"` // 付款金额为负数
+}
+
+// GetBillingHistory 查询账单流水, 按时间倒序排列.
+func (c *Client) GetBillingHistory(ctx context.Context) ([]*BillingEntry, error) {
+	return c.listBilling(ctx, "billing/history", "billing_history")
+}
+
+// GetInvoices 查询发票, 按时间倒序排列.
+func (c *Client) GetInvoices(ctx context.Context) ([]*BillingEntry, error) {
+	return c.listBilling(ctx, "billing/invoices", "billing_invoices")
+}
+
+// BillingEntry 账单流水或发票. 金额单位为美元.
+type BillingEntry struct {
+	ID          int64   `json:"id"`
+	Date        Date    `json:"date"`
+	Type        string  `json:"type"` // 仅账单流水有该字段, 例如 "invoice", "payment"
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	Balance     float64 `json:"balance"`
+}
+
+func (c *Client) listBilling(ctx context.Context, path string, key string) ([]*BillingEntry, error) {
+	var ret []*BillingEntry
+	err := c.list(ctx, path, key, func(data json.RawMessage) error {
+		var page []*BillingEntry
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		ret = append(ret, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Date.After(ret[j].Date.Time)
+	})
+	return ret, nil
+}
+
+// Date RFC 3339 格式的时间, 空字符串为零值.
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if len(s) <= 0 || s == "null" {
+		d.Time = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("invalid date %s: %+v", data, err)
+	}
+	d.Time = t
+	return nil
+}
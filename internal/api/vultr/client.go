@@ -19,38 +19,157 @@
 package vultr
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+const (
+	// DefaultPerPage 列表接口默认的分页大小.
+	DefaultPerPage = 100
+	// MaxPerPage Vultr 允许的最大分页大小.
+	MaxPerPage = 500
 )
 
-// NewClient 返回 Vultr API 客户端.
-func NewClient(apiKey string) *Client {
-	return &Client{apiKey: apiKey}
+// NewClient 返回 Vultr API 客户端. perPage 为列表接口的分页大小, 不大于 0 时使用 DefaultPerPage,
+// 大于 MaxPerPage 时使用 MaxPerPage.
+func NewClient(apiKey string, perPage int) *Client {
+	if perPage <= 0 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+	return &Client{apiKey: apiKey, perPage: perPage}
 }
 
 type Client struct {
-	apiKey string
+	apiKey  string
+	perPage int
 }
 
 // GetInstances 查询所有实例.
 func (c *Client) GetInstances(ctx context.Context) ([]*Instance, error) {
+	var ret []*Instance
+	err := c.list(ctx, "instances", "instances", func(data json.RawMessage) error {
+		var page []*Instance
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		ret = append(ret, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Instance 实例.
+type Instance struct {
+	ID                  string   `json:"id"`
+	Label               string   `json:"label"`
+	Hostname            string   `json:"hostname"`
+	Region              string   `json:"region"`
+	Plan                string   `json:"plan"`
+	OS                  string   `json:"os"`
+	MainIP              string   `json:"main_ip"`
+	V6MainIP            string   `json:"v6_main_ip"`
+	Status              string   `json:"status"`
+	PowerStatus         string   `json:"power_status"`
+	ServerStatus        string   `json:"server_status"`
+	DateCreated         string   `json:"date_created"`
+	Tags                []string `json:"tags"`
+	FirewallGroupID     string   `json:"firewall_group_id"`
+	AllowedBandwidthGiB int      `json:"allowed_bandwidth"`
+}
+
+// HasTag 返回实例是否带有指定标签.
+func (inst *Instance) HasTag(tag string) bool {
+	for _, t := range inst.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedBandwidth 返回实例每月的流量额度.
+func (inst *Instance) AllowedBandwidth() bytesize.Size {
+	return bytesize.Size(inst.AllowedBandwidthGiB) * bytesize.GiB
+}
+
+// GetInstance 查询实例.
+func (c *Client) GetInstance(ctx context.Context, instanceID string) (*Instance, error) {
 	var response struct {
-		Instances []*Instance `json:"instances"`
+		Instance *Instance `json:"instance"`
 	}
 
-	if err := c.get(ctx, "instances", &response); err != nil {
+	if err := c.get(ctx, fmt.Sprintf("instances/%s", instanceID), &response); err != nil {
 		return nil, err
 	}
 
-	return response.Instances, nil
+	return response.Instance, nil
 }
 
-type Instance struct {
-	ID                  string `json:"id"`
-	AllowedBandwidthGiB int    `json:"allowed_bandwidth"`
+// CreateInstanceRequest 创建实例的参数.
+type CreateInstanceRequest struct {
+	Region          string   `json:"region"`
+	Plan            string   `json:"plan"`
+	SnapshotID      string   `json:"snapshot_id,omitempty"`
+	Label           string   `json:"label,omitempty"`
+	Hostname        string   `json:"hostname,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	EnableIPv6      bool     `json:"enable_ipv6,omitempty"`
+	FirewallGroupID string   `json:"firewall_group_id,omitempty"`
+}
+
+// CreateInstance 创建实例. 返回时实例通常仍在安装中.
+func (c *Client) CreateInstance(ctx context.Context, req *CreateInstanceRequest) (*Instance, error) {
+	var response struct {
+		Instance *Instance `json:"instance"`
+	}
+
+	if err := c.post(ctx, "instances", req, &response); err != nil {
+		return nil, err
+	}
+	if response.Instance == nil {
+		return nil, fmt.Errorf("instance is missing in response")
+	}
+
+	return response.Instance, nil
+}
+
+// DeleteInstance 删除实例. 实例中的数据会被销毁且无法恢复.
+func (c *Client) DeleteInstance(ctx context.Context, instanceID string) error {
+	return c.delete(ctx, fmt.Sprintf("instances/%s", instanceID))
+}
+
+// StartInstance 启动实例.
+func (c *Client) StartInstance(ctx context.Context, instanceID string) error {
+	return c.post(ctx, fmt.Sprintf("instances/%s/start", instanceID), nil, nil)
+}
+
+// RebootInstance 重启实例.
+func (c *Client) RebootInstance(ctx context.Context, instanceID string) error {
+	return c.post(ctx, fmt.Sprintf("instances/%s/reboot", instanceID), nil, nil)
+}
+
+// HaltInstance 关闭实例. 关闭后仍会继续计费.
+func (c *Client) HaltInstance(ctx context.Context, instanceID string) error {
+	return c.post(ctx, fmt.Sprintf("instances/%s/halt", instanceID), nil, nil)
 }
 
 // GetInstanceBandwidth 查询实例过去一个月的带宽使用情况.
@@ -67,8 +186,110 @@ func (c *Client) GetInstanceBandwidth(ctx context.Context, instanceID string) (m
 }
 
 type BandwidthUsage struct {
-	IncomingBytes int64 `json:"incoming_bytes"`
-	OutgoingBytes int64 `json:"outgoing_bytes"`
+	IncomingBytes bytesize.Size `json:"incoming_bytes"`
+	OutgoingBytes bytesize.Size `json:"outgoing_bytes"`
+}
+
+// GetAccountBandwidth 查询账户共享带宽的使用情况.
+func (c *Client) GetAccountBandwidth(ctx context.Context) (*AccountBandwidth, error) {
+	var response struct {
+		Bandwidth *AccountBandwidth `json:"bandwidth"`
+	}
+
+	if err := c.get(ctx, "account/bandwidth", &response); err != nil {
+		return nil, err
+	}
+	if response.Bandwidth == nil {
+		return nil, fmt.Errorf("bandwidth is missing in response")
+	}
+
+	return response.Bandwidth, nil
+}
+
+// AccountBandwidth 账户共享带宽的使用情况.
+type AccountBandwidth struct {
+	PreviousMonth         BandwidthPeriod `json:"previous_month"`
+	CurrentMonthToDate    BandwidthPeriod `json:"current_month_to_date"`
+	CurrentMonthProjected BandwidthPeriod `json:"current_month_projected"`
+}
+
+// BandwidthPeriod 一段时间内的账户带宽统计. 流量单位为 GB.
+type BandwidthPeriod struct {
+	Start                     Timestamp `json:"timestamp_start"`
+	End                       Timestamp `json:"timestamp_end"`
+	GBIn                      float64   `json:"gb_in"`
+	GBOut                     float64   `json:"gb_out"`
+	TotalInstanceHours        float64   `json:"total_instance_hours"`
+	TotalInstanceCount        int       `json:"total_instance_count"`
+	InstanceBandwidthCredits  float64   `json:"instance_bandwidth_credits"`
+	FreeBandwidthCredits      float64   `json:"free_bandwidth_credits"`
+	PurchasedBandwidthCredits float64   `json:"purchased_bandwidth_credits"`
+	Overage                   float64   `json:"overage"`
+	OverageUnitCost           float64   `json:"overage_unit_cost"`
+	OverageCost               float64   `json:"overage_cost"`
+}
+
+// Incoming 返回入站流量.
+func (p *BandwidthPeriod) Incoming() bytesize.Size {
+	return gb(p.GBIn)
+}
+
+// Outgoing 返回出站流量. Vultr 只按出站流量计算共享带宽的用量.
+func (p *BandwidthPeriod) Outgoing() bytesize.Size {
+	return gb(p.GBOut)
+}
+
+// Credits 返回各类带宽额度之和.
+func (p *BandwidthPeriod) Credits() bytesize.Size {
+	return gb(p.InstanceBandwidthCredits + p.FreeBandwidthCredits + p.PurchasedBandwidthCredits)
+}
+
+// OverageBandwidth 返回超出额度的流量.
+func (p *BandwidthPeriod) OverageBandwidth() bytesize.Size {
+	return gb(p.Overage)
+}
+
+// gb 与 AllowedBandwidth 一致, 将 Vultr 的 GB 按 GiB 换算.
+func gb(v float64) bytesize.Size {
+	return bytesize.Size(v * float64(bytesize.GiB))
+}
+
+// Timestamp Unix 时间戳, 兼容字符串和数字两种格式.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if len(s) <= 0 || s == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s: %+v", data, err)
+	}
+	t.Time = time.Unix(sec, 0)
+	return nil
+}
+
+// StatusError 接口返回的错误状态码.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("invalid response status code: %d, error: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("invalid response status code: %d", e.StatusCode)
+}
+
+// IsNotFound 返回 err 是否表示资源不存在.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
 }
 
 func (c *Client) getURL(path string) string {
@@ -76,31 +297,108 @@ func (c *Client) getURL(path string) string {
 	return fmt.Sprintf(urlFmt, path)
 }
 
+// list 依次查询列表接口的所有分页, 并对每页中 key 字段的内容调用 appendPage.
+func (c *Client) list(ctx context.Context, path string, key string, appendPage func(data json.RawMessage) error) error {
+	var cursor string
+	seen := make(map[string]bool)
+	for {
+		query := url.Values{}
+		query.Set("per_page", strconv.Itoa(c.perPage))
+		if len(cursor) > 0 {
+			query.Set("cursor", cursor)
+		}
+
+		var page map[string]json.RawMessage
+		if err := c.get(ctx, path+"?"+query.Encode(), &page); err != nil {
+			return err
+		}
+		if data, ok := page[key]; ok {
+			if err := appendPage(data); err != nil {
+				return fmt.Errorf("failed to unmarshal %s: %+v", key, err)
+			}
+		}
+
+		var meta pageMeta
+		if data, ok := page["meta"]; ok {
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return fmt.Errorf("failed to unmarshal meta: %+v", err)
+			}
+		}
+		// 避免接口返回重复的 cursor 导致死循环
+		cursor = meta.Links.Next
+		if len(cursor) <= 0 || seen[cursor] {
+			return nil
+		}
+		seen[cursor] = true
+	}
+}
+
+type pageMeta struct {
+	Total int `json:"total"`
+	Links struct {
+		Next string `json:"next"`
+		Prev string `json:"prev"`
+	} `json:"links"`
+}
+
 func (c *Client) get(ctx context.Context, path string, dest interface{}) error {
-	httpReq, err := http.NewRequest(http.MethodGet, c.getURL(path), nil)
+	return c.do(ctx, http.MethodGet, path, nil, dest)
+}
+
+func (c *Client) post(ctx context.Context, path string, body interface{}, dest interface{}) error {
+	return c.do(ctx, http.MethodPost, path, body, dest)
+}
+
+func (c *Client) patch(ctx context.Context, path string, body interface{}) error {
+	return c.do(ctx, http.MethodPatch, path, body, nil)
+}
+
+func (c *Client) delete(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, dest interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %+v", err)
+		}
+		reqBody = bytes.NewReader(content)
+	}
+
+	httpReq, err := http.NewRequest(method, c.getURL(path), reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to create HTTP request: %+v", err)
 	}
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
 	httpReq = httpReq.WithContext(ctx)
 
 	httpResp, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("failed to do request: %+v", err)
 	}
-	if httpResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid response status code: %d", httpResp.StatusCode)
-	}
 	if httpResp.Body == nil {
 		return fmt.Errorf("response body is nil")
 	}
+	defer httpResp.Body.Close()
 
 	respBody, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %+v", err)
 	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(respBody, &errResp)
+		return &StatusError{StatusCode: httpResp.StatusCode, Message: errResp.Error}
+	}
 
-	if dest == nil {
+	if dest == nil || len(respBody) <= 0 {
 		return nil
 	}
 	if err := json.Unmarshal(respBody, dest); err != nil {
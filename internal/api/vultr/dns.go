@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package vultr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Domain DNS 域名.
+type Domain struct {
+	Domain      string `json:"domain"`
+	DateCreated Date   `json:"date_created"`
+	DNSSEC      string `json:"dns_sec"` // "enabled" 或 "disabled"
+}
+
+// Record DNS 记录. Name 为空时表示域名本身.
+type Record struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Data     string `json:"data"`
+	Priority int    `json:"priority"`
+	TTL      int    `json:"ttl"`
+}
+
+// GetDomains 查询所有 DNS 域名.
+func (c *Client) GetDomains(ctx context.Context) ([]*Domain, error) {
+	var ret []*Domain
+	err := c.list(ctx, "domains", "domains", func(data json.RawMessage) error {
+		var page []*Domain
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		ret = append(ret, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// GetRecords 查询域名的所有 DNS 记录.
+func (c *Client) GetRecords(ctx context.Context, domain string) ([]*Record, error) {
+	var ret []*Record
+	err := c.list(ctx, recordsPath(domain), "records", func(data json.RawMessage) error {
+		var page []*Record
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		ret = append(ret, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// CreateRecord 创建 DNS 记录. record 的 ID 会被忽略, TTL 和 Priority 为 0 时使用默认值.
+func (c *Client) CreateRecord(ctx context.Context, domain string, record *Record) (*Record, error) {
+	request := struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Data     string `json:"data"`
+		TTL      int    `json:"ttl,omitempty"`
+		Priority int    `json:"priority,omitempty"`
+	}{
+		Name:     record.Name,
+		Type:     record.Type,
+		Data:     record.Data,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+	}
+	var response struct {
+		Record *Record `json:"record"`
+	}
+
+	if err := c.post(ctx, recordsPath(domain), &request, &response); err != nil {
+		return nil, err
+	}
+	if response.Record == nil {
+		return nil, fmt.Errorf("record is missing in response")
+	}
+
+	return response.Record, nil
+}
+
+// UpdateRecord 修改 DNS 记录的名称, 内容和 TTL. 记录的类型不能修改.
+func (c *Client) UpdateRecord(ctx context.Context, domain string, record *Record) error {
+	request := struct {
+		Name     string `json:"name"`
+		Data     string `json:"data"`
+		TTL      int    `json:"ttl,omitempty"`
+		Priority int    `json:"priority,omitempty"`
+	}{
+		Name:     record.Name,
+		Data:     record.Data,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+	}
+
+	return c.patch(ctx, fmt.Sprintf("%s/%s", recordsPath(domain), record.ID), &request)
+}
+
+// DeleteRecord 删除 DNS 记录.
+func (c *Client) DeleteRecord(ctx context.Context, domain string, recordID string) error {
+	return c.delete(ctx, fmt.Sprintf("%s/%s", recordsPath(domain), recordID))
+}
+
+func recordsPath(domain string) string {
+	return fmt.Sprintf("domains/%s/records", url.PathEscape(domain))
+}
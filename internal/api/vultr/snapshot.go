@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package vultr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+// Snapshot 快照.
+type Snapshot struct {
+	ID             string        `json:"id"`
+	DateCreated    Date          `json:"date_created"`
+	Description    string        `json:"description"`
+	Size           bytesize.Size `json:"size"`
+	CompressedSize bytesize.Size `json:"compressed_size"`
+	Status         string        `json:"status"` // "pending" 或 "complete"
+	OSID           int           `json:"os_id"`
+	AppID          int           `json:"app_id"`
+}
+
+// GetSnapshots 查询所有快照.
+func (c *Client) GetSnapshots(ctx context.Context) ([]*Snapshot, error) {
+	var ret []*Snapshot
+	err := c.list(ctx, "snapshots", "snapshots", func(data json.RawMessage) error {
+		var page []*Snapshot
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		ret = append(ret, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// GetSnapshot 查询快照.
+func (c *Client) GetSnapshot(ctx context.Context, snapshotID string) (*Snapshot, error) {
+	var response struct {
+		Snapshot *Snapshot `json:"snapshot"`
+	}
+
+	if err := c.get(ctx, fmt.Sprintf("snapshots/%s", snapshotID), &response); err != nil {
+		return nil, err
+	}
+	if response.Snapshot == nil {
+		return nil, fmt.Errorf("snapshot is missing in response")
+	}
+
+	return response.Snapshot, nil
+}
+
+// CreateSnapshot 为实例创建快照. 返回时快照通常仍在创建中.
+func (c *Client) CreateSnapshot(ctx context.Context, instanceID string, description string) (*Snapshot, error) {
+	request := struct {
+		InstanceID  string `json:"instance_id"`
+		Description string `json:"description,omitempty"`
+	}{
+		InstanceID:  instanceID,
+		Description: description,
+	}
+	var response struct {
+		Snapshot *Snapshot `json:"snapshot"`
+	}
+
+	if err := c.post(ctx, "snapshots", &request, &response); err != nil {
+		return nil, err
+	}
+	if response.Snapshot == nil {
+		return nil, fmt.Errorf("snapshot is missing in response")
+	}
+
+	return response.Snapshot, nil
+}
+
+// DeleteSnapshot 删除快照.
+func (c *Client) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	return c.delete(ctx, fmt.Sprintf("snapshots/%s", snapshotID))
+}
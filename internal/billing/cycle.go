@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package billing
+
+import (
+	"time"
+)
+
+// Cycle 计费周期, 范围为 [Start, End).
+type Cycle struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CycleAt 返回 t 所在的计费周期.
+//
+// 计费周期在 location 时区每月 startDay 日零点开始. startDay 超过当月天数时
+// 按当月最后一天计算, 例如 startDay 为 31 时 2 月的周期从 2 月 28 日 (或 29 日) 开始.
+func CycleAt(t time.Time, location *time.Location, startDay int) Cycle {
+	if startDay < 1 {
+		startDay = 1
+	}
+
+	t = t.In(location)
+	start := cycleStart(t.Year(), t.Month(), startDay, location)
+	if t.Before(start) {
+		start = cycleStart(t.Year(), t.Month()-1, startDay, location)
+	}
+	end := cycleStart(start.Year(), start.Month()+1, startDay, location)
+	return Cycle{Start: start, End: end}
+}
+
+func cycleStart(year int, month time.Month, day int, location *time.Location) time.Time {
+	// 规范化年月, 例如 month 为 0 时表示上一年的 12 月
+	first := time.Date(year, month, 1, 0, 0, 0, 0, location)
+	if last := daysIn(first.Year(), first.Month()); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, location)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Contains 返回 t 是否在计费周期内.
+func (c Cycle) Contains(t time.Time) bool {
+	return !t.Before(c.Start) && t.Before(c.End)
+}
+
+// Elapsed 返回 now 时周期已经过去的比例, 范围为 [0, 1].
+func (c Cycle) Elapsed(now time.Time) float64 {
+	total := c.End.Sub(c.Start)
+	if total <= 0 || now.Before(c.Start) {
+		return 0
+	}
+	if !now.Before(c.End) {
+		return 1
+	}
+	return float64(now.Sub(c.Start)) / float64(total)
+}
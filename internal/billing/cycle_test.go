@@ -0,0 +1,186 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package billing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCycleAt(t *testing.T) {
+	// 东八区, 不依赖系统时区数据
+	cst := time.FixedZone("CST", 8*60*60)
+	date := func(year int, month time.Month, day, hour, min int, loc *time.Location) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		location  *time.Location
+		startDay  int
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "月中",
+			t:         date(2022, 3, 20, 12, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  15,
+			wantStart: date(2022, 3, 15, 0, 0, time.UTC),
+			wantEnd:   date(2022, 4, 15, 0, 0, time.UTC),
+		},
+		{
+			name:      "跨年, 12 月",
+			t:         date(2022, 12, 20, 0, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  15,
+			wantStart: date(2022, 12, 15, 0, 0, time.UTC),
+			wantEnd:   date(2023, 1, 15, 0, 0, time.UTC),
+		},
+		{
+			name:      "跨年, 1 月",
+			t:         date(2023, 1, 10, 0, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  15,
+			wantStart: date(2022, 12, 15, 0, 0, time.UTC),
+			wantEnd:   date(2023, 1, 15, 0, 0, time.UTC),
+		},
+		{
+			name:      "31 日, 平年 2 月",
+			t:         date(2022, 2, 28, 12, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  31,
+			wantStart: date(2022, 2, 28, 0, 0, time.UTC),
+			wantEnd:   date(2022, 3, 31, 0, 0, time.UTC),
+		},
+		{
+			name:      "31 日, 平年 2 月之前",
+			t:         date(2022, 2, 27, 12, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  31,
+			wantStart: date(2022, 1, 31, 0, 0, time.UTC),
+			wantEnd:   date(2022, 2, 28, 0, 0, time.UTC),
+		},
+		{
+			name:      "31 日, 闰年 2 月",
+			t:         date(2024, 2, 29, 12, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  31,
+			wantStart: date(2024, 2, 29, 0, 0, time.UTC),
+			wantEnd:   date(2024, 3, 31, 0, 0, time.UTC),
+		},
+		{
+			name:      "31 日, 闰年 2 月之前",
+			t:         date(2024, 2, 28, 12, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  31,
+			wantStart: date(2024, 1, 31, 0, 0, time.UTC),
+			wantEnd:   date(2024, 2, 29, 0, 0, time.UTC),
+		},
+		{
+			name:      "正好在周期开始",
+			t:         date(2022, 5, 1, 0, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  1,
+			wantStart: date(2022, 5, 1, 0, 0, time.UTC),
+			wantEnd:   date(2022, 6, 1, 0, 0, time.UTC),
+		},
+		{
+			name:      "周期结束之前",
+			t:         date(2022, 6, 1, 0, 0, time.UTC).Add(-time.Nanosecond),
+			location:  time.UTC,
+			startDay:  1,
+			wantStart: date(2022, 5, 1, 0, 0, time.UTC),
+			wantEnd:   date(2022, 6, 1, 0, 0, time.UTC),
+		},
+		{
+			name: "非 UTC 时区",
+			// UTC 时间还在 4 月 30 日, 东八区已经是 5 月 1 日
+			t:         date(2022, 4, 30, 16, 30, time.UTC),
+			location:  cst,
+			startDay:  1,
+			wantStart: date(2022, 5, 1, 0, 0, cst),
+			wantEnd:   date(2022, 6, 1, 0, 0, cst),
+		},
+		{
+			name: "非 UTC 时区, 周期开始之前",
+			// 东八区还是 4 月 30 日 23:59
+			t:         date(2022, 4, 30, 15, 59, time.UTC),
+			location:  cst,
+			startDay:  1,
+			wantStart: date(2022, 4, 1, 0, 0, cst),
+			wantEnd:   date(2022, 5, 1, 0, 0, cst),
+		},
+		{
+			name:      "startDay 为 0",
+			t:         date(2022, 7, 10, 0, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  0,
+			wantStart: date(2022, 7, 1, 0, 0, time.UTC),
+			wantEnd:   date(2022, 8, 1, 0, 0, time.UTC),
+		},
+		{
+			name:      "startDay 为负数",
+			t:         date(2022, 7, 10, 0, 0, time.UTC),
+			location:  time.UTC,
+			startDay:  -3,
+			wantStart: date(2022, 7, 1, 0, 0, time.UTC),
+			wantEnd:   date(2022, 8, 1, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		got := CycleAt(tt.t, tt.location, tt.startDay)
+		if !got.Start.Equal(tt.wantStart) || !got.End.Equal(tt.wantEnd) {
+			t.Errorf("%s: CycleAt(%v, %d) = [%v, %v), want [%v, %v)",
+				tt.name, tt.t, tt.startDay, got.Start, got.End, tt.wantStart, tt.wantEnd)
+			continue
+		}
+		if got.Start.Location() != tt.location {
+			t.Errorf("%s: CycleAt(%v, %d) location = %v, want %v",
+				tt.name, tt.t, tt.startDay, got.Start.Location(), tt.location)
+		}
+		if !got.Contains(tt.t) {
+			t.Errorf("%s: cycle [%v, %v) does not contain %v", tt.name, got.Start, got.End, tt.t)
+		}
+	}
+}
+
+func TestCycleContains(t *testing.T) {
+	c := Cycle{
+		Start: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{t: c.Start, want: true},
+		{t: c.End.Add(-time.Nanosecond), want: true},
+		{t: c.End, want: false},
+		{t: c.Start.Add(-time.Nanosecond), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := c.Contains(tt.t); got != tt.want {
+			t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Account 查询账户概况.
+func (bot *Bot) Account(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := bot.dler.GetUserInfo(ctx)
+	if err != nil {
+		log.Errorf("failed to get user info from Dler Cloud, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+
+	if _, err := bot.telebot.Send(m.Chat, bot.renderAccount(info), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown}); err != nil {
+		log.Errorf("failed to send account info, error: %+v", err)
+	}
+}
+
+func (bot *Bot) renderAccount(info *dler.UserInfo) string {
+	var b strings.Builder
+	b.WriteString("*Dler Cloud*\n")
+
+	// 内容来自接口, 需要转义
+	line := func(label, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(&b, "%s: %s\n", label, escapeMarkdown(value))
+		}
+	}
+	// 接口未返回的流量字段不显示
+	sizeLine := func(label, field string, size bytesize.Size) {
+		if info.Has(field) {
+			line(label, bot.formatSize(size))
+		}
+	}
+
+	line("套餐", info.Plan)
+	if len(info.PlanTime) > 0 {
+		if expiry, ok := info.PlanExpiry(bot.location); ok {
+			remaining := time.Until(expiry)
+			if remaining > 0 {
+				days := int(math.Ceil(remaining.Hours() / 24))
+				line("到期时间", fmt.Sprintf("%s（剩余 %d 天）", expiry.Format("2006-01-02"), days))
+			} else {
+				line("到期时间", fmt.Sprintf("%s（已过期）", expiry.Format("2006-01-02")))
+			}
+		} else {
+			line("到期时间", info.PlanTime)
+		}
+	}
+	line("余额", info.Money)
+	line("返利余额", info.AffMoney)
+	line("积分", info.Integral)
+	sizeLine("今日已用", "today_used", info.TodayUsed)
+	sizeLine("已用流量", "used", info.Used)
+	sizeLine("可用流量", "unused", info.Unused)
+	if info.Has("traffic") && info.Traffic > 0 {
+		line("总流量", bot.formatSize(info.Traffic))
+		b.WriteString(usageBar(info.Used.Ratio(info.Traffic)))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// usageBar 返回使用比例的进度条, 例如 "▓▓▓▓░░░░░░ 40.0%".
+func usageBar(ratio float64) string {
+	const width = 10
+
+	filled := int(math.Round(math.Min(math.Max(ratio, 0), 1) * width))
+	return fmt.Sprintf("%s%s %.1f%%", strings.Repeat("▓", filled), strings.Repeat("░", width-filled), ratio*100)
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/config"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+	"dlercloud-telegarm-bot/internal/state"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	defaultAlertInterval = 10 * time.Minute
+
+	// 告警恢复需要回到阈值之外的余量, 避免在阈值附近反复告警
+	alertHysteresisRatio   = 0.1
+	alertHysteresisPercent = 5
+)
+
+// loadAlertRules 解析配置文件中的告警规则.
+func (bot *Bot) loadAlertRules(cfg *config.Config) error {
+	bot.alertRules = make([]*state.AlertRule, 0, len(cfg.Alert.Rules))
+	for i, r := range cfg.Alert.Rules {
+		rule := &state.AlertRule{
+			ID:          fmt.Sprintf("c%d", i+1),
+			Provider:    r.Provider,
+			Instance:    r.Instance,
+			UsedPercent: r.UsedPercent,
+			Projected:   r.Projected,
+		}
+		if len(r.Remaining) > 0 {
+			remaining, err := bytesize.Parse(r.Remaining, bot.sizeSystem)
+			if err != nil {
+				return fmt.Errorf("invalid remaining of alert rule #%d: %+v", i+1, err)
+			}
+			rule.Remaining = remaining
+		}
+		if err := bot.validateAlertRule(rule); err != nil {
+			return fmt.Errorf("invalid alert rule #%d: %+v", i+1, err)
+		}
+		bot.alertRules = append(bot.alertRules, rule)
+	}
+	return nil
+}
+
+func (bot *Bot) validateAlertRule(rule *state.AlertRule) error {
+	if _, ok := bot.providers.Get(rule.Provider); !ok {
+		return fmt.Errorf("unknown provider %q", rule.Provider)
+	}
+
+	if (rule.Remaining > 0) == (rule.UsedPercent > 0) {
+		return fmt.Errorf("exactly one of remaining and used-percent should be set")
+	}
+	if rule.UsedPercent > 100 {
+		return fmt.Errorf("used-percent should not be greater than 100")
+	}
+	return nil
+}
+
+// checkAlerts 检查所有告警规则, 每次越过阈值只告警一次.
+func (bot *Bot) checkAlerts() {
+	rules := bot.allAlertRules()
+	if len(rules) <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	targets := bot.collectUsage(ctx)
+
+	var messages []string
+	err := bot.state.Update(func(d *state.Data) {
+		if d.Alert.Firing == nil {
+			d.Alert.Firing = make(map[string]bool)
+		}
+		firing := make(map[string]bool, len(d.Alert.Firing))
+
+		for _, rule := range rules {
+			for _, target := range targets {
+				if !rule.Matches(target.Provider, target.Name) {
+					continue
+				}
+				key := rule.ID + "@" + target.Key()
+				wasFiring := d.Alert.Firing[key]
+				if target.Err != nil {
+					// 查询失败时保持原有状态
+					if wasFiring {
+						firing[key] = true
+					}
+					continue
+				}
+				isFiring := evaluateAlertRule(rule, target, wasFiring)
+				if isFiring && !wasFiring {
+					messages = append(messages, bot.renderAlert(rule, target))
+				}
+				if isFiring {
+					firing[key] = true
+				}
+			}
+		}
+
+		// 只保留仍在告警的条目, 已删除的规则和对象会被一并清理
+		d.Alert.Firing = firing
+	})
+	if err != nil {
+		log.Errorf("failed to save alert state, error: %+v", err)
+	}
+
+	for _, msg := range messages {
+		bot.notify(msg)
+	}
+}
+
+// allAlertRules 返回配置文件中和运行时添加的所有规则.
+func (bot *Bot) allAlertRules() []*state.AlertRule {
+	rules := make([]*state.AlertRule, 0, len(bot.alertRules))
+	rules = append(rules, bot.alertRules...)
+	bot.state.View(func(d *state.Data) {
+		for _, rule := range d.Alert.Rules {
+			copied := *rule
+			rules = append(rules, &copied)
+		}
+	})
+	return rules
+}
+
+// evaluateAlertRule 返回对象当前是否处于告警状态. 已在告警的对象需要回到阈值之外一定余量才会恢复.
+func evaluateAlertRule(rule *state.AlertRule, target *provider.Usage, wasFiring bool) bool {
+	// 共享额度的对象没有自己的剩余流量, 规则应针对提供额度的对象
+	if len(target.Pool) > 0 {
+		return false
+	}
+
+	used, unused := alertUsage(rule, target)
+	if rule.Remaining > 0 {
+		threshold := rule.Remaining
+		if wasFiring {
+			threshold += bytesize.Size(float64(rule.Remaining) * alertHysteresisRatio)
+		}
+		return unused <= threshold
+	}
+
+	if target.Total <= 0 {
+		return false
+	}
+	percent := used.Ratio(target.Total) * 100
+	threshold := rule.UsedPercent
+	if wasFiring {
+		threshold -= alertHysteresisPercent
+	}
+	return percent >= threshold
+}
+
+// alertUsage 返回规则判断使用的已用和剩余流量. 按预测判断的规则使用预计的周期末用量.
+func alertUsage(rule *state.AlertRule, target *provider.Usage) (used bytesize.Size, unused bytesize.Size) {
+	if rule.Projected {
+		projected := target.Used
+		if target.Forecast != nil && target.Forecast.Projected > 0 {
+			projected = target.Forecast.Projected
+		}
+		return projected, target.Total - projected
+	}
+	return target.Used, target.Unused
+}
+
+func (bot *Bot) renderAlert(rule *state.AlertRule, target *provider.Usage) string {
+	used, unused := alertUsage(rule, target)
+	prefix, label := "", "可用流量"
+	if rule.Projected {
+		prefix, label = "预计周期末", "剩余流量"
+	}
+
+	var msg string
+	if rule.Remaining > 0 {
+		msg = fmt.Sprintf("[流量告警] %s %s%s %s，低于 %s", target.Name, prefix, label, bot.formatSize(unused), bot.formatSize(rule.Remaining))
+	} else {
+		msg = fmt.Sprintf("[流量告警] %s %s已使用 %.1f%% 流量，超过 %.1f%%", target.Name, prefix, used.Ratio(target.Total)*100, rule.UsedPercent)
+	}
+	msg += fmt.Sprintf("\n已用流量: %s\n可用流量: %s", bot.formatSize(target.Used), bot.formatSize(target.Unused))
+	if forecast := bot.renderForecast(target); len(forecast) > 0 {
+		msg += "\n" + forecast
+	}
+	return msg
+}
+
+func (bot *Bot) describeAlertRule(rule *state.AlertRule) string {
+	target := rule.Provider
+	if len(rule.Instance) > 0 {
+		target += ":" + rule.Instance
+	}
+	prefix := ""
+	if rule.Projected {
+		prefix = "预计"
+	}
+	if rule.Remaining > 0 {
+		return fmt.Sprintf("#%s %s %s可用流量 ≤ %s", rule.ID, target, prefix, bot.formatSize(rule.Remaining))
+	}
+	return fmt.Sprintf("#%s %s %s已用比例 ≥ %.1f%%", rule.ID, target, prefix, rule.UsedPercent)
+}
+
+// Alerts 管理告警规则.
+//
+//	/alerts
+//	/alerts add <服务[:对象名]> remaining <流量> [projected]
+//	/alerts add <服务[:对象名]> used <百分比> [projected]
+//	/alerts del <规则 ID>
+func (bot *Bot) Alerts(m *telebot.Message) {
+	args := strings.Fields(m.Payload)
+	if len(args) <= 0 {
+		bot.telebot.Send(m.Chat, bot.listAlertRules())
+		return
+	}
+
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以修改告警规则")
+		return
+	}
+
+	var reply string
+	switch args[0] {
+	case "add":
+		reply = bot.addAlertRule(args[1:])
+	case "del", "rm":
+		reply = bot.deleteAlertRule(args[1:])
+	default:
+		reply = alertsUsage
+	}
+	bot.telebot.Send(m.Chat, reply)
+}
+
+const alertsUsage = `用法:
+/alerts
+/alerts add <服务[:对象名]> remaining <流量，如 10GiB> [projected]
+/alerts add <服务[:对象名]> used <百分比，如 90> [projected]
+/alerts del <规则 ID>
+
+加上 projected 时按预计的周期末用量判断`
+
+func (bot *Bot) listAlertRules() string {
+	rules := bot.allAlertRules()
+	if len(rules) <= 0 {
+		return "暂无告警规则\n\n" + alertsUsage
+	}
+
+	var b strings.Builder
+	b.WriteString("告警规则:\n")
+	for i, rule := range rules {
+		b.WriteString(bot.describeAlertRule(rule))
+		if i < len(bot.alertRules) {
+			b.WriteString("（配置文件）")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (bot *Bot) addAlertRule(args []string) string {
+	projected := len(args) == 4 && args[3] == "projected"
+	if projected {
+		args = args[:3]
+	}
+	if len(args) != 3 {
+		return alertsUsage
+	}
+
+	rule := &state.AlertRule{Projected: projected}
+	rule.Provider = args[0]
+	if i := strings.Index(args[0], ":"); i >= 0 {
+		rule.Provider, rule.Instance = args[0][:i], args[0][i+1:]
+	}
+
+	switch args[1] {
+	case "remaining":
+		remaining, err := bytesize.Parse(args[2], bot.sizeSystem)
+		if err != nil {
+			return fmt.Sprintf("无效的流量: %s", args[2])
+		}
+		rule.Remaining = remaining
+	case "used":
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(args[2], "%"), 64)
+		if err != nil {
+			return fmt.Sprintf("无效的百分比: %s", args[2])
+		}
+		rule.UsedPercent = percent
+	default:
+		return alertsUsage
+	}
+	if err := bot.validateAlertRule(rule); err != nil {
+		return fmt.Sprintf("无效的告警规则: %v", err)
+	}
+
+	err := bot.state.Update(func(d *state.Data) {
+		d.Alert.NextID++
+		rule.ID = strconv.Itoa(d.Alert.NextID)
+		d.Alert.Rules = append(d.Alert.Rules, rule)
+	})
+	if err != nil {
+		log.Errorf("failed to save alert rule, error: %+v", err)
+		return "Opps，保存失败"
+	}
+	return "已添加告警规则 " + bot.describeAlertRule(rule)
+}
+
+func (bot *Bot) deleteAlertRule(args []string) string {
+	if len(args) != 1 {
+		return alertsUsage
+	}
+	id := strings.TrimPrefix(args[0], "#")
+
+	for _, rule := range bot.alertRules {
+		if rule.ID == id {
+			return "配置文件中的规则无法删除"
+		}
+	}
+
+	deleted := false
+	err := bot.state.Update(func(d *state.Data) {
+		for i, rule := range d.Alert.Rules {
+			if rule.ID == id {
+				d.Alert.Rules = append(d.Alert.Rules[:i], d.Alert.Rules[i+1:]...)
+				deleted = true
+				return
+			}
+		}
+	})
+	if err != nil {
+		log.Errorf("failed to save alert rules, error: %+v", err)
+		return "Opps，保存失败"
+	}
+	if !deleted {
+		return fmt.Sprintf("规则 #%s 不存在", id)
+	}
+	return fmt.Sprintf("已删除规则 #%s", id)
+}
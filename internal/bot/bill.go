@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// 显示的最近发票数量.
+const billInvoices = 5
+
+// Bill 查询各服务的余额和账单.
+func (bot *Bot) Bill(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		wg          sync.WaitGroup
+		info        *dler.UserInfo
+		account     *vultr.Account
+		invoices    []*vultr.BillingEntry
+		errDler     error
+		errAccount  error
+		errInvoices error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		info, errDler = bot.dler.GetUserInfo(ctx)
+	}()
+	if bot.vultr != nil {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			account, errAccount = bot.vultr.GetAccount(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			invoices, errInvoices = bot.vultr.GetInvoices(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	b.WriteString("*Dler Cloud*\n")
+	if errDler != nil {
+		log.Errorf("failed to get user info from Dler Cloud, error: %+v", errDler)
+		b.WriteString("⚠️ 查询失败\n")
+	} else {
+		fmt.Fprintf(&b, "余额: %s\n", info.Money)
+	}
+
+	if bot.vultr != nil {
+		b.WriteString("\n*Vultr*\n")
+		if errAccount != nil {
+			log.Errorf("failed to get Vultr account, error: %+v", errAccount)
+			b.WriteString("⚠️ 查询失败\n")
+		} else {
+			bot.writeVultrAccount(&b, account)
+		}
+
+		if errInvoices != nil {
+			log.Errorf("failed to get Vultr invoices, error: %+v", errInvoices)
+			b.WriteString("⚠️ 发票查询失败\n")
+		} else if len(invoices) > 0 {
+			bot.writeInvoices(&b, invoices)
+		}
+	}
+
+	bot.telebot.Send(m.Chat, b.String(), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+}
+
+func (bot *Bot) writeVultrAccount(b *strings.Builder, account *vultr.Account) {
+	// Vultr 的余额为负数时表示账户中有余额
+	if account.Balance <= 0 {
+		fmt.Fprintf(b, "余额: $%.2f\n", -account.Balance)
+	} else {
+		fmt.Fprintf(b, "欠款: $%.2f\n", account.Balance)
+	}
+	fmt.Fprintf(b, "本月待结算: $%.2f\n", account.PendingCharges)
+	if !account.LastPaymentDate.IsZero() {
+		fmt.Fprintf(b, "上次付款: %s $%.2f\n",
+			account.LastPaymentDate.In(bot.location).Format("2006-01-02"), math.Abs(account.LastPaymentAmount))
+	}
+}
+
+func (bot *Bot) writeInvoices(b *strings.Builder, invoices []*vultr.BillingEntry) {
+	if len(invoices) > billInvoices {
+		invoices = invoices[:billInvoices]
+	}
+
+	var total float64
+	rows := [][]string{{"日期", "发票", "金额"}}
+	for _, invoice := range invoices {
+		rows = append(rows, []string{
+			invoice.Date.In(bot.location).Format("2006-01-02"),
+			fmt.Sprintf("#%d", invoice.ID),
+			fmt.Sprintf("$%.2f", invoice.Amount),
+		})
+		total += invoice.Amount
+	}
+	rows = append(rows, []string{"合计", "", fmt.Sprintf("$%.2f", total)})
+
+	fmt.Fprintf(b, "最近 %d 张发票:\n```\n", len(invoices))
+	writeTable(b, rows)
+	b.WriteString("```\n")
+}
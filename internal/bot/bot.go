@@ -21,12 +21,21 @@ package bot
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/api/subscription"
 	"dlercloud-telegarm-bot/internal/api/vultr"
 	"dlercloud-telegarm-bot/internal/bot/internal/middleware"
+	"dlercloud-telegarm-bot/internal/bytesize"
 	"dlercloud-telegarm-bot/internal/config"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+	"dlercloud-telegarm-bot/internal/state"
 
 	"gopkg.in/tucnak/telebot.v2"
 )
@@ -34,21 +43,39 @@ import (
 // NewBot 返回新的 bot 实例.
 func NewBot(cfg *config.Config) *Bot {
 	bot := &Bot{
+		cfg:              cfg,
 		dler:             dler.NewClient(cfg.DlerCloud.Email, cfg.DlerCloud.Password),
-		vultrEnabled:     cfg.Vultr.Enabled,
+		autoCheckinAt:    cfg.DlerCloud.AutoCheckin,
+		subDeleteAfter:   time.Duration(cfg.DlerCloud.SubDeleteAfter) * time.Second,
+		reminderEnabled:  cfg.Reminder.Enabled,
+		reminderInterval: time.Duration(cfg.Reminder.Interval) * time.Second,
+		expiryDays:       cfg.Reminder.ExpiryDays,
+		alertInterval:    time.Duration(cfg.Alert.Interval) * time.Second,
 		telebotSettings:  telebot.Settings{Token: cfg.Telegram.BotToken},
 		allowedRecipient: cfg.Telegram.AllowedRecipient,
+		admins:           make(map[int64]bool, len(cfg.Telegram.Admins)),
+		statePath:        cfg.State.Path,
+		sizeUnits:        cfg.Display.SizeUnits,
+	}
+	for _, id := range cfg.Telegram.Admins {
+		bot.admins[id] = true
+	}
+	if bot.subDeleteAfter <= 0 {
+		bot.subDeleteAfter = defaultSubDeleteAfter
+	}
+	if bot.reminderInterval <= 0 {
+		bot.reminderInterval = defaultReminderInterval
+	}
+	if len(bot.expiryDays) <= 0 {
+		bot.expiryDays = defaultExpiryDays
+	}
+	if bot.alertInterval <= 0 {
+		bot.alertInterval = defaultAlertInterval
 	}
 
 	if cfg.Vultr.Enabled {
-		bot.vultrInstances = make([]*vultrInstance, 0, len(cfg.Vultr.Instances))
-		for name, inst := range cfg.Vultr.Instances {
-			bot.vultrInstances = append(bot.vultrInstances, &vultrInstance{
-				Name:       name,
-				InstanceID: inst.ID,
-			})
-		}
-		bot.vultr = vultr.NewClient(cfg.Vultr.APIKey)
+		bot.vultr = vultr.NewClient(cfg.Vultr.APIKey, cfg.Vultr.PerPage)
+		bot.loadGuards()
 	}
 
 	return bot
@@ -56,58 +83,227 @@ func NewBot(cfg *config.Config) *Bot {
 
 // Bot.
 type Bot struct {
-	dler *dler.Client
+	cfg *config.Config
+
+	dler           *dler.Client
+	autoCheckinAt  string
+	subDeleteAfter time.Duration
+
+	reminderEnabled  bool
+	reminderInterval time.Duration
+	expiryDays       []int
+
+	alertInterval time.Duration
+	alertRules    []*state.AlertRule // 配置文件中的规则, 运行时添加的规则保存在 state 中
 
-	vultrEnabled   bool
-	vultrInstances []*vultrInstance
 	vultr          *vultr.Client
+	vultrProvider  *provider.Vultr
+	guards         map[string]*instanceGuard // 按实例名称
+	guardRehearsed map[string]time.Time      // 演练模式下各实例已提醒的计费周期, 不保存
+	ddns           []*ddnsRecord
+	ddnsInterval   time.Duration
+	ddnsMu         sync.Mutex
+
+	providers *provider.Registry
 
 	telebotSettings  telebot.Settings
 	allowedRecipient string
+	admins           map[int64]bool
+	confirmations    pendingConfirmations
 
-	telebot *telebot.Bot
-}
+	statePath string
+	state     *state.Store
+
+	location *time.Location
 
-type vultrInstance struct {
-	Name       string
-	InstanceID string
+	sizeUnits  string
+	sizeSystem bytesize.System
+
+	telebot *telebot.Bot
 }
 
 // Start 启动 bot.
 func (bot *Bot) Start() error {
-	if err := bot.loginToDler(); err != nil {
-		return fmt.Errorf("failed to log in to Dler Cloud, error: %+v", err)
+	location, err := loadLocation(bot.cfg.Display.Timezone, defaultTimezone)
+	if err != nil {
+		return fmt.Errorf("failed to load timezone, error: %+v", err)
+	}
+	bot.location = location
+
+	if err := bot.registerProviders(); err != nil {
+		return fmt.Errorf("failed to register providers, error: %+v", err)
+	}
+
+	sizeSystem, err := bytesize.ParseSystem(bot.sizeUnits)
+	if err != nil {
+		return fmt.Errorf("invalid size units, error: %+v", err)
 	}
+	bot.sizeSystem = sizeSystem
+
+	if err := bot.loadAlertRules(bot.cfg); err != nil {
+		return fmt.Errorf("failed to load alert rules, error: %+v", err)
+	}
+
+	if err := bot.loadDDNS(bot.cfg); err != nil {
+		return fmt.Errorf("failed to load DDNS records, error: %+v", err)
+	}
+
+	if err := bot.loadState(); err != nil {
+		return fmt.Errorf("failed to load state, error: %+v", err)
+	}
+
+	bot.loginToDler()
 
 	if err := bot.createTelebot(); err != nil {
 		return fmt.Errorf("failed to create Telegram bot, error: %+v", err)
 	}
 
 	bot.registerRoutes()
-	bot.telebot.Start()
+	bot.restoreRotations()
+	bot.restoreGuards()
+	if err := bot.startSchedules(); err != nil {
+		return fmt.Errorf("failed to start schedules, error: %+v", err)
+	}
+	bot.run()
+	return nil
+}
+
+// registerProviders 按配置注册流量服务.
+func (bot *Bot) registerProviders() error {
+	bot.providers = provider.NewRegistry()
+	bot.providers.Register(provider.NewDlerCloud(bot.dler, provider.DlerCloudOptions{
+		Location: bot.location,
+		ResetDay: bot.cfg.DlerCloud.ResetDay,
+	}))
+
+	if len(bot.cfg.Subscriptions.URLs) > 0 {
+		names := make([]string, 0, len(bot.cfg.Subscriptions.URLs))
+		for name := range bot.cfg.Subscriptions.URLs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		urls := make([]*provider.SubscriptionURL, 0, len(names))
+		for _, name := range names {
+			urls = append(urls, &provider.SubscriptionURL{
+				Name: name,
+				URL:  bot.cfg.Subscriptions.URLs[name].URL,
+			})
+		}
+		client := subscription.NewClient(bot.cfg.Subscriptions.UserAgent)
+		bot.providers.Register(provider.NewSubscriptions(client, urls))
+	}
+
+	if bot.vultr != nil {
+		location, err := loadLocation(bot.cfg.Vultr.Timezone, "UTC")
+		if err != nil {
+			return fmt.Errorf("failed to load Vultr timezone: %+v", err)
+		}
+
+		names := make([]string, 0, len(bot.cfg.Vultr.Instances))
+		for name := range bot.cfg.Vultr.Instances {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		instances := make([]*provider.VultrInstance, 0, len(names))
+		for _, name := range names {
+			counted, err := provider.ParseDirection(bot.cfg.Vultr.Instances[name].Counted)
+			if err != nil {
+				return fmt.Errorf("invalid counted direction of Vultr instance %s: %+v", name, err)
+			}
+			instances = append(instances, &provider.VultrInstance{
+				Name:       name,
+				InstanceID: bot.cfg.Vultr.Instances[name].ID,
+				Exclude:    bot.cfg.Vultr.Instances[name].Exclude,
+				Counted:    counted,
+			})
+		}
+
+		bot.vultrProvider = provider.NewVultr(bot.vultr, provider.VultrOptions{
+			Instances:     instances,
+			Location:      location,
+			CycleStartDay: bot.cfg.Vultr.CycleStartDay,
+			AutoDiscover:  bot.cfg.Vultr.AutoDiscover,
+			Tags:          bot.cfg.Vultr.DiscoverTags,
+			Regions:       bot.cfg.Vultr.DiscoverRegions,
+			Pooled:        bot.cfg.Vultr.Pooled,
+		})
+		bot.providers.Register(bot.vultrProvider)
+	}
 	return nil
 }
 
-func (bot *Bot) loginToDler() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (bot *Bot) loadState() error {
+	s, err := state.Open(bot.statePath)
+	if err != nil {
+		return err
+	}
+	bot.state = s
+
+	bot.dler.OnTokenChanged(func(token string) {
+		err := bot.state.Update(func(d *state.Data) {
+			d.Dler.Token = token
+			d.Dler.TokenTime = time.Now()
+		})
+		if err != nil {
+			log.Errorf("failed to save Dler Cloud token, error: %+v", err)
+		}
+	})
+	return nil
+}
+
+// loginToDler 登录 Dler Cloud. 登录失败不影响启动, 之后的请求会自动重新登录.
+func (bot *Bot) loginToDler() {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	return bot.dler.Login(ctx)
+	var token string
+	bot.state.View(func(d *state.Data) {
+		token = d.Dler.Token
+	})
+	if len(token) <= 0 {
+		if err := bot.dler.Login(ctx); err != nil {
+			log.Errorf("failed to log in to Dler Cloud, will retry on the next request, error: %+v", err)
+		}
+		return
+	}
+
+	// 复用上次保存的 token, 若已失效 GetUserInfo 会自动重新登录
+	bot.dler.SetToken(token)
+	if _, err := bot.dler.GetUserInfo(ctx); err != nil {
+		log.Errorf("failed to verify cached Dler Cloud token, error: %+v", err)
+	}
 }
 
 func (bot *Bot) createTelebot() error {
-	b, err := telebot.NewBot(bot.telebotSettings)
+	// 同步处理使 ProcessUpdate 在 handler 返回后才返回, 以便处理完成后再保存 update ID
+	settings := bot.telebotSettings
+	settings.Synchronous = true
+	b, err := telebot.NewBot(settings)
 	if err != nil {
 		return err
 	}
 
+	var lastUpdateID int
+	bot.state.View(func(d *state.Data) {
+		lastUpdateID = d.Telegram.LastUpdateID
+	})
+
 	// 添加 logger 中间件
-	b.Poller = telebot.NewMiddlewarePoller(&telebot.LongPoller{Timeout: 10 * time.Second}, bot.middleware())
+	poller := &telebot.LongPoller{Timeout: 10 * time.Second, LastUpdateID: lastUpdateID}
+	b.Poller = telebot.NewMiddlewarePoller(poller, bot.middleware())
 
 	bot.telebot = b
 	return nil
 }
 
+// privateEndpoints 管理员可以在私聊中使用的命令和按钮, 不受 allowedRecipient 限制.
+var privateEndpoints = map[string]bool{
+	"/sub":          true,
+	subButtonUnique: true,
+}
+
 func (bot *Bot) middleware() func(u *telebot.Update) bool {
 	return func(u *telebot.Update) bool {
 		if u == nil {
@@ -116,7 +312,7 @@ func (bot *Bot) middleware() func(u *telebot.Update) bool {
 		if !middleware.Logger(u) {
 			return false
 		}
-		if !middleware.FilterRecipient(bot.allowedRecipient)(u) {
+		if !middleware.FilterRecipient(bot.allowedRecipient, bot.admins, privateEndpoints)(u) {
 			return false
 		}
 		return true
@@ -124,6 +320,184 @@ func (bot *Bot) middleware() func(u *telebot.Update) bool {
 
 }
 
+// run 拉取 update 并在各自的 goroutine 中处理, 不会返回.
+//
+// 只保存已处理完成的最大连续 update ID, 处理中途退出的 update 会在重启后重新处理 (至少一次).
+// 被中间件过滤的 update 不会保存 ID, 重启后会再次被过滤.
+func (bot *Bot) run() {
+	go bot.telebot.Poller.Poll(bot.telebot, bot.telebot.Updates, make(chan struct{}))
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[int]bool)
+		maxSeen  int
+		saved    int
+	)
+	bot.state.View(func(d *state.Data) {
+		saved = d.Telegram.LastUpdateID
+	})
+	for u := range bot.telebot.Updates {
+		mu.Lock()
+		inFlight[u.ID] = true
+		if u.ID > maxSeen {
+			maxSeen = u.ID
+		}
+		mu.Unlock()
+
+		go func(u telebot.Update) {
+			bot.telebot.ProcessUpdate(u)
+
+			mu.Lock()
+			defer mu.Unlock()
+			delete(inFlight, u.ID)
+
+			// 所有更早的 update 都已处理完成时才能前移
+			done := maxSeen
+			for id := range inFlight {
+				if id-1 < done {
+					done = id - 1
+				}
+			}
+			if done > saved {
+				saved = done
+				bot.saveUpdateID(done)
+			}
+		}(u)
+	}
+}
+
+func (bot *Bot) saveUpdateID(id int) {
+	err := bot.state.Update(func(d *state.Data) {
+		d.Telegram.LastUpdateID = id
+	})
+	if err != nil {
+		log.Errorf("failed to save update ID %d, error: %+v", id, err)
+	}
+}
+
 func (bot *Bot) registerRoutes() {
 	bot.telebot.Handle("/info", bot.Info)
+	bot.telebot.Handle("/account", bot.Account)
+	bot.telebot.Handle("/bill", bot.Bill)
+	bot.telebot.Handle("/checkin", bot.Checkin)
+	bot.telebot.Handle("/sub", bot.Sub)
+	bot.telebot.Handle("/alerts", bot.Alerts)
+	bot.telebot.Handle("/health", bot.Health)
+	bot.telebot.Handle("/vultr", bot.Vultr)
+	bot.telebot.Handle("/chart", bot.Chart)
+	bot.telebot.Handle("/snapshot", bot.Snapshot)
+	bot.telebot.Handle("/rotate", bot.Rotate)
+	bot.telebot.Handle("/dns", bot.DNS)
+	bot.telebot.Handle(&telebot.Btn{Unique: confirmButtonUnique}, bot.onConfirm)
+	bot.telebot.Handle(&telebot.Btn{Unique: subButtonUnique}, bot.onSubSelected)
+}
+
+func (bot *Bot) startSchedules() error {
+	if len(bot.autoCheckinAt) > 0 {
+		at, err := parseClock(bot.autoCheckinAt)
+		if err != nil {
+			return fmt.Errorf("invalid auto-checkin time: %+v", err)
+		}
+		bot.runDaily(at, bot.autoCheckin)
+	}
+	if bot.reminderEnabled {
+		bot.runEvery(bot.reminderInterval, bot.checkReminders)
+	}
+	bot.runEvery(bot.alertInterval, bot.checkAlerts)
+	bot.runEvery(bot.alertInterval, bot.checkGuards)
+	if err := bot.startReports(); err != nil {
+		return err
+	}
+	if err := bot.startSnapshotSchedules(); err != nil {
+		return err
+	}
+	if len(bot.ddns) > 0 {
+		bot.runEvery(bot.ddnsInterval, bot.syncDNS)
+	}
+	return nil
+}
+
+const defaultTimezone = "Asia/Shanghai"
+
+// loadLocation 加载时区, name 为空时使用 defaultName.
+func loadLocation(name string, defaultName string) (*time.Location, error) {
+	if len(name) <= 0 {
+		name = defaultName
+	}
+	return time.LoadLocation(name)
+}
+
+// formatSize 按配置的单位制格式化数据量.
+func (bot *Bot) formatSize(size bytesize.Size) string {
+	return size.Format(bot.sizeSystem)
+}
+
+// formatDuration 以中文输出时长, 例如 "1 小时 30 分钟", 忽略不足一秒的部分.
+func formatDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	if d <= 0 {
+		return "0 秒"
+	}
+
+	var parts []string
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{24 * time.Hour, "天"},
+		{time.Hour, "小时"},
+		{time.Minute, "分钟"},
+		{time.Second, "秒"},
+	}
+	for _, u := range units {
+		if n := d / u.unit; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, u.name))
+			d -= n * u.unit
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// markdownEscaper 转义 Telegram Markdown (旧版) 中有特殊含义的字符.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// escapeMarkdown 转义文本, 使其在 Markdown 消息中按原样显示.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// isAdmin 返回用户是否为管理员.
+func (bot *Bot) isAdmin(user *telebot.User) bool {
+	return user != nil && bot.admins[user.ID]
+}
+
+// notify 向 allowedRecipient 发送通知. 未配置 allowedRecipient 时仅输出日志.
+func (bot *Bot) notify(msg string, options ...interface{}) {
+	if len(bot.allowedRecipient) <= 0 {
+		log.Infof("notification: %s", msg)
+		return
+	}
+	if _, err := bot.telebot.Send(recipient(bot.allowedRecipient), msg, options...); err != nil {
+		log.Errorf("failed to send notification, error: %+v", err)
+	}
+}
+
+// notifyAdmins 向各管理员的私聊发送通知. 未配置管理员时发送给 allowedRecipient.
+func (bot *Bot) notifyAdmins(msg string, options ...interface{}) {
+	if len(bot.admins) <= 0 {
+		bot.notify(msg, options...)
+		return
+	}
+	for id := range bot.admins {
+		if _, err := bot.telebot.Send(recipient(strconv.FormatInt(id, 10)), msg, options...); err != nil {
+			log.Errorf("failed to send notification to admin %d, error: %+v", id, err)
+		}
+	}
+}
+
+// recipient 以 ID 表示的消息接收方.
+type recipient string
+
+func (r recipient) Recipient() string {
+	return string(r)
 }
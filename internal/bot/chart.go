@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/chart"
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	maxChartDays = 30
+	chartWidth   = 960
+	chartHeight  = 480
+)
+
+// Chart 绘制 Vultr 实例的每日带宽柱状图.
+//
+//	/chart <实例名> [天数]
+func (bot *Bot) Chart(m *telebot.Message) {
+	if bot.vultrProvider == nil {
+		bot.telebot.Send(m.Chat, "未启用 Vultr")
+		return
+	}
+
+	args := strings.Fields(m.Payload)
+	if len(args) < 1 || len(args) > 2 {
+		bot.telebot.Send(m.Chat, "用法: /chart <实例名> [天数]")
+		return
+	}
+	days := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 || n > maxChartDays {
+			bot.telebot.Send(m.Chat, fmt.Sprintf("天数应为 1 到 %d 之间的整数", maxChartDays))
+			return
+		}
+		days = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst, err := bot.findVultrInstance(ctx, args[0])
+	if err != nil {
+		log.Errorf("failed to query Vultr instances, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if inst == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 不存在", args[0]))
+		return
+	}
+
+	// 默认显示本计费周期
+	cycle := bot.vultrProvider.Cycle(time.Now())
+	if days <= 0 {
+		days = int(time.Since(cycle.Start).Hours()/24) + 1
+	}
+	daily, err := bot.vultrProvider.RecentBandwidth(ctx, inst.InstanceID, days)
+	if err != nil {
+		log.Errorf("failed to get bandwidth of Vultr instance %s, error: %+v", inst.InstanceID, err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+
+	var (
+		bars                           = make([]chart.Bar, 0, len(daily))
+		cumulative, incoming, outgoing bytesize.Size
+		peak                           bytesize.Size
+		peakDate                       time.Time
+	)
+	for _, d := range daily {
+		bar := chart.Bar{
+			Label:      d.Date.Format("02"),
+			Incoming:   float64(d.Incoming),
+			Outgoing:   float64(d.Outgoing),
+			Cumulative: -1,
+		}
+		if cycle.Contains(d.Date) {
+			cumulative += d.Counted(inst.Counted)
+			bar.Cumulative = float64(cumulative)
+		}
+		if d.Total() > peak {
+			peak, peakDate = d.Total(), d.Date
+		}
+		incoming += d.Incoming
+		outgoing += d.Outgoing
+		bars = append(bars, bar)
+	}
+
+	allowance := inst.Instance.AllowedBandwidth()
+	img := chart.Bandwidth(bars, chart.Options{
+		Width:     chartWidth,
+		Height:    chartHeight,
+		Allowance: float64(allowance),
+		FormatValue: func(v float64) string {
+			return bot.formatSize(bytesize.Size(v))
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		log.Errorf("failed to encode chart, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，绘图失败")
+		return
+	}
+
+	caption := fmt.Sprintf("%s 最近 %d 天带宽\n蓝色: 入站 %s，橙色: 出站 %s（左轴）\n绿色: 本周期累计 %s，红色虚线: 额度 %s（右轴）",
+		inst.Name, len(daily), bot.formatSize(incoming), bot.formatSize(outgoing), bot.formatSize(cumulative), bot.formatSize(allowance))
+	if peak > 0 {
+		caption += fmt.Sprintf("\n峰值: %s %s", peakDate.Format("01-02"), bot.formatSize(peak))
+	}
+
+	photo := &telebot.Photo{File: telebot.FromReader(&buf), Caption: caption}
+	if _, err := bot.telebot.Send(m.Chat, photo); err != nil {
+		log.Errorf("failed to send chart, error: %+v", err)
+	}
+}
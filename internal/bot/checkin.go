@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Checkin 签到.
+func (bot *Bot) Checkin(m *telebot.Message) {
+	bot.telebot.Send(m.Chat, bot.checkin())
+}
+
+// autoCheckin 定时签到, 并将结果发送给 allowedRecipient.
+func (bot *Bot) autoCheckin() {
+	bot.notify("[自动签到] " + bot.checkin())
+}
+
+func (bot *Bot) checkin() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := bot.dler.Checkin(ctx)
+	if errors.Is(err, dler.ErrAlreadyCheckedIn) {
+		return "今天已经签到过了"
+	}
+	if err != nil {
+		log.Errorf("failed to check in to Dler Cloud, error: %+v", err)
+		return "Opps，签到失败"
+	}
+
+	if result.Traffic <= 0 {
+		return fmt.Sprintf("签到成功: %s", result.Message)
+	}
+	return fmt.Sprintf("签到成功，获得流量: %s\n可用流量: %s", bot.formatSize(result.Traffic), bot.formatSize(result.Unused))
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const confirmButtonUnique = "confirm"
+
+// confirmation 需要管理员通过按钮确认的操作.
+type confirmation struct {
+	Text        string
+	ConfirmText string // 默认为 "确认"
+	CancelText  string // 默认为 "取消"
+	TTL         time.Duration
+
+	OnConfirm func(msg *telebot.Message)
+	OnCancel  func(msg *telebot.Message)
+	OnExpire  func(msg *telebot.Message) // 超时后调用, 为空时将消息编辑为已过期
+}
+
+type pendingConfirmations struct {
+	mu      sync.Mutex
+	pending map[string]*confirmation
+}
+
+// take 取出并移除指定的操作, 保证每个操作只处理一次.
+func (p *pendingConfirmations) take(id string) *confirmation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conf := p.pending[id]
+	delete(p.pending, id)
+	return conf
+}
+
+func (p *pendingConfirmations) put(id string, conf *confirmation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending == nil {
+		p.pending = make(map[string]*confirmation)
+	}
+	p.pending[id] = conf
+}
+
+// askConfirm 发送带有确认和取消按钮的消息. 按钮在 TTL 后失效.
+func (bot *Bot) askConfirm(to telebot.Recipient, conf *confirmation) (*telebot.Message, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	confirmText, cancelText := conf.ConfirmText, conf.CancelText
+	if len(confirmText) <= 0 {
+		confirmText = "确认"
+	}
+	if len(cancelText) <= 0 {
+		cancelText = "取消"
+	}
+
+	markup := new(telebot.ReplyMarkup)
+	markup.Inline(markup.Row(
+		markup.Data(confirmText, confirmButtonUnique, "yes:"+id),
+		markup.Data(cancelText, confirmButtonUnique, "no:"+id),
+	))
+
+	msg, err := bot.telebot.Send(to, conf.Text, markup)
+	if err != nil {
+		return nil, err
+	}
+
+	bot.confirmations.put(id, conf)
+	time.AfterFunc(conf.TTL, func() {
+		if bot.confirmations.take(id) == nil {
+			return
+		}
+		if conf.OnExpire != nil {
+			conf.OnExpire(msg)
+			return
+		}
+		bot.telebot.Edit(msg, conf.Text+"\n\n已过期，未执行")
+	})
+	return msg, nil
+}
+
+func (bot *Bot) onConfirm(c *telebot.Callback) {
+	if !bot.isAdmin(c.Sender) {
+		bot.telebot.Respond(c, &telebot.CallbackResponse{Text: "仅管理员可以操作"})
+		return
+	}
+	defer bot.telebot.Respond(c)
+
+	i := strings.Index(c.Data, ":")
+	if i < 0 {
+		return
+	}
+	answer, id := c.Data[:i], c.Data[i+1:]
+
+	conf := bot.confirmations.take(id)
+	if conf == nil {
+		bot.telebot.EditReplyMarkup(c.Message, nil)
+		return
+	}
+
+	log.Infof("confirmation %s answered %s by %d", id, answer, c.Sender.ID)
+	if answer == "yes" {
+		conf.OnConfirm(c.Message)
+		return
+	}
+	if conf.OnCancel != nil {
+		conf.OnCancel(c.Message)
+		return
+	}
+	bot.telebot.Edit(c.Message, conf.Text+"\n\n已取消")
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/config"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	defaultDDNSInterval = 5 * time.Minute
+	dnsConfirmTTL       = 30 * time.Second
+)
+
+// ddnsRecord 指向实例 IP 的 DNS 记录.
+type ddnsRecord struct {
+	Instance string
+	Domain   string
+	Name     string // 为空时表示域名本身
+	TTL      int
+	IPv6     bool // 同时维护 AAAA 记录
+}
+
+// FQDN 返回记录的完整域名.
+func (r *ddnsRecord) FQDN() string {
+	return recordFQDN(r.Domain, r.Name)
+}
+
+func recordFQDN(domain string, name string) string {
+	if len(name) <= 0 {
+		return domain
+	}
+	return name + "." + domain
+}
+
+// loadDDNS 解析配置文件中的 DDNS 记录.
+func (bot *Bot) loadDDNS(cfg *config.Config) error {
+	bot.ddnsInterval = time.Duration(cfg.Vultr.DDNSInterval) * time.Second
+	if bot.ddnsInterval <= 0 {
+		bot.ddnsInterval = defaultDDNSInterval
+	}
+
+	bot.ddns = make([]*ddnsRecord, 0, len(cfg.Vultr.DDNS))
+	for i, r := range cfg.Vultr.DDNS {
+		if len(r.Instance) <= 0 || len(r.Domain) <= 0 {
+			return fmt.Errorf("instance and domain of DDNS record #%d are required", i+1)
+		}
+		bot.ddns = append(bot.ddns, &ddnsRecord{
+			Instance: r.Instance,
+			Domain:   r.Domain,
+			Name:     recordName(r.Name),
+			TTL:      r.TTL,
+			IPv6:     r.IPv6,
+		})
+	}
+	if len(bot.ddns) > 0 && bot.vultr == nil {
+		return fmt.Errorf("vultr is not enabled")
+	}
+	return nil
+}
+
+// recordName 将表示域名本身的 "@" 转换为 Vultr 使用的空名称.
+func recordName(name string) string {
+	if name == "@" {
+		return ""
+	}
+	return name
+}
+
+// syncDNS 将 DDNS 记录更新为实例当前的 IP, 有变化时通知管理员.
+func (bot *Bot) syncDNS() {
+	if len(bot.ddns) <= 0 {
+		return
+	}
+
+	bot.ddnsMu.Lock()
+	defer bot.ddnsMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	instances, err := bot.vultrProvider.ResolveInstances(ctx)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances for DDNS, error: %+v", err)
+		return
+	}
+	byName := make(map[string]*provider.VultrInstance, len(instances))
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+
+	records := make(map[string][]*vultr.Record)
+	for _, r := range bot.ddns {
+		inst := byName[r.Instance]
+		if inst == nil || inst.Instance == nil {
+			log.Errorf("Vultr instance %s of DDNS record %s not found", r.Instance, r.FQDN())
+			continue
+		}
+
+		existing, ok := records[r.Domain]
+		if !ok {
+			if existing, err = bot.vultr.GetRecords(ctx, r.Domain); err != nil {
+				log.Errorf("failed to get DNS records of %s, error: %+v", r.Domain, err)
+				continue
+			}
+			records[r.Domain] = existing
+		}
+
+		bot.syncRecord(ctx, r, "A", inst.Instance.MainIP, existing)
+		if r.IPv6 {
+			bot.syncRecord(ctx, r, "AAAA", inst.Instance.V6MainIP, existing)
+		}
+	}
+}
+
+// syncRecord 确保存在类型为 typ, 内容为 ip 的记录. 已有同名同类型的记录时修改第一条.
+func (bot *Bot) syncRecord(ctx context.Context, r *ddnsRecord, typ string, ip string, existing []*vultr.Record) {
+	// 新实例安装完成前没有可用的 IP
+	if len(ip) <= 0 || ip == "0.0.0.0" || ip == "::" {
+		return
+	}
+
+	var current *vultr.Record
+	for _, record := range existing {
+		if record.Name != r.Name || record.Type != typ {
+			continue
+		}
+		if record.Data == ip {
+			return
+		}
+		if current == nil {
+			current = record
+		}
+	}
+
+	if current == nil {
+		_, err := bot.vultr.CreateRecord(ctx, r.Domain, &vultr.Record{Name: r.Name, Type: typ, Data: ip, TTL: r.TTL})
+		if err != nil {
+			log.Errorf("failed to create %s record of %s, error: %+v", typ, r.FQDN(), err)
+			return
+		}
+		log.Infof("created %s record of %s: %s", typ, r.FQDN(), ip)
+		bot.notifyAdmins(fmt.Sprintf("[DDNS] 已添加 %s %s 记录: %s", r.FQDN(), typ, ip))
+		return
+	}
+
+	old := current.Data
+	updated := *current
+	updated.Data = ip
+	if r.TTL > 0 {
+		updated.TTL = r.TTL
+	}
+	if err := bot.vultr.UpdateRecord(ctx, r.Domain, &updated); err != nil {
+		log.Errorf("failed to update %s record of %s, error: %+v", typ, r.FQDN(), err)
+		return
+	}
+	current.Data = ip
+	log.Infof("updated %s record of %s: %s -> %s", typ, r.FQDN(), old, ip)
+	bot.notifyAdmins(fmt.Sprintf("[DDNS] 已更新 %s %s 记录: %s → %s", r.FQDN(), typ, old, ip))
+}
+
+const dnsUsage = `用法:
+/dns
+/dns list <域名>
+/dns add <域名> <名称> <类型> <内容> [TTL]
+/dns set <域名> <记录 ID> <内容> [TTL]
+/dns del <域名> <记录 ID>
+名称为 @ 时表示域名本身`
+
+// DNS 管理 Vultr DNS 记录.
+//
+//	/dns
+//	/dns list <域名>
+//	/dns add <域名> <名称> <类型> <内容> [TTL]
+//	/dns set <域名> <记录 ID> <内容> [TTL]
+//	/dns del <域名> <记录 ID>
+func (bot *Bot) DNS(m *telebot.Message) {
+	if bot.vultr == nil {
+		bot.telebot.Send(m.Chat, "未启用 Vultr")
+		return
+	}
+
+	args := strings.Fields(m.Payload)
+	if len(args) <= 0 {
+		bot.listDomains(m)
+		return
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 2:
+		bot.listRecords(m, args[1])
+	case args[0] == "add" && (len(args) == 5 || len(args) == 6):
+		bot.addRecord(m, args[1:])
+	case args[0] == "set" && (len(args) == 4 || len(args) == 5):
+		bot.setRecord(m, args[1:])
+	case args[0] == "del" && len(args) == 3:
+		bot.deleteRecord(m, args[1], args[2])
+	default:
+		bot.telebot.Send(m.Chat, dnsUsage)
+	}
+}
+
+func (bot *Bot) listDomains(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	domains, err := bot.vultr.GetDomains(ctx)
+	if err != nil {
+		log.Errorf("failed to get Vultr domains, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if len(domains) <= 0 {
+		bot.telebot.Send(m.Chat, "没有域名")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("域名:\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "%s\n", domain.Domain)
+	}
+	bot.telebot.Send(m.Chat, b.String())
+}
+
+func (bot *Bot) listRecords(m *telebot.Message, domain string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, err := bot.vultr.GetRecords(ctx, domain)
+	if err != nil {
+		log.Errorf("failed to get DNS records of %s, error: %+v", domain, err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if len(records) <= 0 {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("%s 没有记录", domain))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("```\n")
+	for _, record := range records {
+		name := record.Name
+		if len(name) <= 0 {
+			name = "@"
+		}
+		fmt.Fprintf(&b, "%s %s %s TTL %d\n  %s\n", name, record.Type, record.Data, record.TTL, record.ID)
+	}
+	b.WriteString("```")
+	bot.telebot.Send(m.Chat, b.String(), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+}
+
+// parseTTL 解析可选的 TTL 参数, 为空时返回 0 以使用默认值.
+func parseTTL(args []string, i int) (int, bool) {
+	if len(args) <= i {
+		return 0, true
+	}
+	ttl, err := strconv.Atoi(args[i])
+	return ttl, err == nil && ttl > 0
+}
+
+func (bot *Bot) addRecord(m *telebot.Message, args []string) {
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以修改 DNS 记录")
+		return
+	}
+
+	ttl, ok := parseTTL(args, 4)
+	if !ok {
+		bot.telebot.Send(m.Chat, "TTL 应为正整数")
+		return
+	}
+	domain := args[0]
+	record := &vultr.Record{
+		Name: recordName(args[1]),
+		Type: strings.ToUpper(args[2]),
+		Data: args[3],
+		TTL:  ttl,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	created, err := bot.vultr.CreateRecord(ctx, domain, record)
+	if err != nil {
+		log.Errorf("failed to create DNS record of %s, error: %+v", domain, err)
+		bot.telebot.Send(m.Chat, fmt.Sprintf("Opps，添加失败: %v", err))
+		return
+	}
+	log.Infof("created DNS record %s of %s", created.ID, domain)
+	bot.telebot.Send(m.Chat, fmt.Sprintf("已添加 %s %s 记录: %s\nID: %s", recordFQDN(domain, created.Name), created.Type, created.Data, created.ID))
+}
+
+// findRecord 按 ID 查找记录.
+func (bot *Bot) findRecord(ctx context.Context, domain string, recordID string) (*vultr.Record, error) {
+	records, err := bot.vultr.GetRecords(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.ID == recordID {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+func (bot *Bot) setRecord(m *telebot.Message, args []string) {
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以修改 DNS 记录")
+		return
+	}
+
+	ttl, ok := parseTTL(args, 3)
+	if !ok {
+		bot.telebot.Send(m.Chat, "TTL 应为正整数")
+		return
+	}
+	domain, recordID, data := args[0], args[1], args[2]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	record, err := bot.findRecord(ctx, domain, recordID)
+	if err != nil {
+		log.Errorf("failed to get DNS records of %s, error: %+v", domain, err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if record == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("记录 %s 不存在", recordID))
+		return
+	}
+
+	old := record.Data
+	record.Data = data
+	if ttl > 0 {
+		record.TTL = ttl
+	}
+	if err := bot.vultr.UpdateRecord(ctx, domain, record); err != nil {
+		log.Errorf("failed to update DNS record %s of %s, error: %+v", recordID, domain, err)
+		bot.telebot.Send(m.Chat, fmt.Sprintf("Opps，修改失败: %v", err))
+		return
+	}
+	log.Infof("updated DNS record %s of %s: %s -> %s", recordID, domain, old, data)
+	bot.telebot.Send(m.Chat, fmt.Sprintf("已修改 %s %s 记录: %s → %s", recordFQDN(domain, record.Name), record.Type, old, data))
+}
+
+func (bot *Bot) deleteRecord(m *telebot.Message, domain string, recordID string) {
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以修改 DNS 记录")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	record, err := bot.findRecord(ctx, domain, recordID)
+	if err != nil {
+		log.Errorf("failed to get DNS records of %s, error: %+v", domain, err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if record == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("记录 %s 不存在", recordID))
+		return
+	}
+
+	fqdn := recordFQDN(domain, record.Name)
+	_, err = bot.askConfirm(m.Chat, &confirmation{
+		Text: fmt.Sprintf("确认删除 %s %s 记录 %s？", fqdn, record.Type, record.Data),
+		TTL:  dnsConfirmTTL,
+		OnConfirm: func(msg *telebot.Message) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := bot.vultr.DeleteRecord(ctx, domain, recordID); err != nil {
+				log.Errorf("failed to delete DNS record %s of %s, error: %+v", recordID, domain, err)
+				bot.telebot.Edit(msg, fmt.Sprintf("Opps，删除 %s %s 记录失败", fqdn, record.Type))
+				return
+			}
+			log.Infof("deleted DNS record %s of %s", recordID, domain)
+			bot.telebot.Edit(msg, fmt.Sprintf("已删除 %s %s 记录 %s", fqdn, record.Type, record.Data))
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to send confirmation, error: %+v", err)
+	}
+}
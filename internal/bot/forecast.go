@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/forecast"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+	"dlercloud-telegarm-bot/internal/state"
+)
+
+// 每个对象保留的快照数量.
+const maxSnapshots = 15
+
+// attachForecasts 为查询结果附加用量预测. 服务不提供每日用量时, 使用每天保存的快照估算.
+// 服务已给出预测的对象保持不变.
+func (bot *Bot) attachForecasts(usages []*provider.Usage) {
+	now := time.Now()
+
+	snapshots := make(map[string][]state.Snapshot)
+	bot.state.View(func(d *state.Data) {
+		for _, usage := range usages {
+			if usage.Err != nil || usage.Forecast != nil || len(usage.Daily) > 0 {
+				continue
+			}
+			snapshots[usage.Key()] = append([]state.Snapshot(nil), d.Snapshots[usage.Key()]...)
+		}
+	})
+
+	// 当天的快照已保存时不写入状态文件
+	changed := make(map[string][]state.Snapshot)
+	for _, usage := range usages {
+		if usage.Err != nil || usage.Forecast != nil {
+			continue
+		}
+
+		daily := usage.Daily
+		if len(daily) <= 0 {
+			key := usage.Key()
+			if updated, ok := bot.recordSnapshot(snapshots[key], usage, now); ok {
+				snapshots[key] = updated
+				changed[key] = updated
+			}
+			daily = snapshotRates(snapshots[key])
+		}
+		usage.Forecast = forecast.Project(usage.Used, usage.Total, daily, now, usage.ResetAt)
+	}
+	if len(changed) <= 0 {
+		return
+	}
+
+	err := bot.state.Update(func(d *state.Data) {
+		if d.Snapshots == nil {
+			d.Snapshots = make(map[string][]state.Snapshot)
+		}
+		for key, snapshots := range changed {
+			d.Snapshots[key] = snapshots
+		}
+	})
+	if err != nil {
+		log.Errorf("failed to save snapshots, error: %+v", err)
+	}
+}
+
+// recordSnapshot 每天保存一次已用流量快照. 当天已有快照时返回 false.
+func (bot *Bot) recordSnapshot(snapshots []state.Snapshot, usage *provider.Usage, now time.Time) ([]state.Snapshot, bool) {
+	today := now.In(bot.location).Format("2006-01-02")
+	if len(snapshots) > 0 && snapshots[len(snapshots)-1].Time.In(bot.location).Format("2006-01-02") == today {
+		return snapshots, false
+	}
+
+	snapshots = append(snapshots, state.Snapshot{Time: now, Used: usage.Used})
+	if len(snapshots) > maxSnapshots {
+		snapshots = snapshots[len(snapshots)-maxSnapshots:]
+	}
+	return snapshots, true
+}
+
+// snapshotRates 返回由快照计算的日均用量序列.
+func snapshotRates(snapshots []state.Snapshot) []bytesize.Size {
+	var daily []bytesize.Size
+	for i := 1; i < len(snapshots); i++ {
+		prev, cur := snapshots[i-1], snapshots[i]
+		days := cur.Time.Sub(prev.Time).Hours() / 24
+		// 流量重置后用量减少, 跳过这段时间
+		if days <= 0 || cur.Used < prev.Used {
+			continue
+		}
+		daily = append(daily, bytesize.Size(float64(cur.Used-prev.Used)/days))
+	}
+	return daily
+}
+
+// renderForecast 输出用量预测, 例如 "预计用量: 1.60 TiB / 2.00 TiB，27 日用尽".
+func (bot *Bot) renderForecast(usage *provider.Usage) string {
+	f := usage.Forecast
+	if f == nil {
+		return ""
+	}
+
+	var msg string
+	if f.Projected > 0 && usage.Total > 0 {
+		msg = fmt.Sprintf("预计用量: %s / %s", bot.formatSize(f.Projected), bot.formatSize(usage.Total))
+	} else if f.Projected > 0 {
+		msg = fmt.Sprintf("预计用量: %s", bot.formatSize(f.Projected))
+	} else {
+		msg = fmt.Sprintf("日均用量: %s", bot.formatSize(f.DailyRate))
+	}
+	if !f.RunsOutAt.IsZero() {
+		runsOut := f.RunsOutAt.In(bot.location)
+		if now := time.Now().In(bot.location); runsOut.Year() == now.Year() && runsOut.Month() == now.Month() {
+			msg += fmt.Sprintf("，%d 日用尽", runsOut.Day())
+		} else {
+			msg += fmt.Sprintf("，%s 用尽", runsOut.Format("2006-01-02"))
+		}
+	}
+	return msg
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/billing"
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+	"dlercloud-telegarm-bot/internal/state"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	defaultGuardPercent = 95
+	defaultGuardGrace   = 10 * time.Minute
+)
+
+// instanceGuard 实例的流量保护: 使用量超过额度的一定比例时自动关机, 避免超额计费.
+type instanceGuard struct {
+	Name      string
+	Percent   float64
+	Projected bool // 按预计的周期末使用量判断
+	Grace     time.Duration
+}
+
+func (bot *Bot) loadGuards() {
+	bot.guards = make(map[string]*instanceGuard)
+	bot.guardRehearsed = make(map[string]time.Time)
+	for name, inst := range bot.cfg.Vultr.Instances {
+		if !inst.Guard {
+			continue
+		}
+		guard := &instanceGuard{
+			Name:      name,
+			Percent:   inst.GuardPercent,
+			Projected: inst.GuardProjected,
+			Grace:     time.Duration(inst.GuardGrace) * time.Second,
+		}
+		if guard.Percent <= 0 {
+			guard.Percent = defaultGuardPercent
+		}
+		if guard.Grace <= 0 {
+			guard.Grace = defaultGuardGrace
+		}
+		bot.guards[name] = guard
+	}
+}
+
+// checkGuards 检查开启流量保护的实例.
+func (bot *Bot) checkGuards() {
+	if bot.vultrProvider == nil || len(bot.guards) <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	cycle := bot.vultrProvider.Cycle(now)
+	instances, err := bot.vultrProvider.ResolveInstances(ctx)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances for guards, error: %+v", err)
+		return
+	}
+	byName := make(map[string]*provider.VultrInstance, len(instances))
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+
+	usages := bot.vultrProvider.FetchInstancesUsage(ctx, instances)
+	bot.attachForecasts(usages)
+	pools := make(map[string]*provider.Usage)
+	for _, usage := range usages {
+		pools[usage.Name] = usage
+	}
+	for _, usage := range usages {
+		guard, ok := bot.guards[usage.Name]
+		if !ok || usage.Err != nil {
+			continue
+		}
+		inst := byName[usage.Name]
+		if inst == nil || inst.Instance == nil || inst.Instance.PowerStatus != "running" {
+			continue
+		}
+
+		// 共享额度时按账户的用量判断
+		limited, owner := usage, ""
+		if len(usage.Pool) > 0 {
+			limited, owner = pools[usage.Pool], usage.Pool
+			if limited == nil || limited.Err != nil {
+				continue
+			}
+		}
+		if limited.Total <= 0 {
+			continue
+		}
+
+		value, label := limited.Used, "已用"
+		if guard.Projected {
+			value, label = projectedUsage(limited, cycle.Elapsed(now)), "预计"
+		}
+		percent := value.Ratio(limited.Total) * 100
+		if percent < guard.Percent {
+			continue
+		}
+
+		reason := fmt.Sprintf("%s 本周期%s流量 %s，达到额度 %s 的 %.1f%%（阈值 %.1f%%）",
+			inst.Name, label, bot.formatSize(value), bot.formatSize(limited.Total), percent, guard.Percent)
+		if len(owner) > 0 {
+			reason = fmt.Sprintf("%s 所在的%s本周期%s流量 %s，达到共享额度 %s 的 %.1f%%（阈值 %.1f%%）",
+				inst.Name, owner, label, bot.formatSize(value), bot.formatSize(limited.Total), percent, guard.Percent)
+		}
+		bot.triggerGuard(inst, guard, cycle, reason)
+	}
+}
+
+// projectedUsage 返回预计的周期末用量. 没有用量预测时 (例如周期的第一天), 按周期已过去的比例线性估算.
+func projectedUsage(usage *provider.Usage, elapsed float64) bytesize.Size {
+	if usage.Forecast != nil && usage.Forecast.Projected > 0 {
+		return usage.Forecast.Projected
+	}
+	if elapsed <= 0 {
+		return usage.Used
+	}
+	return bytesize.Size(float64(usage.Used) / elapsed)
+}
+
+// triggerGuard 触发流量保护. 每个计费周期只触发一次, 关机成功或取消后本周期内不再触发.
+// 触发记录按实例名称保存, 重建实例后仍然有效.
+func (bot *Bot) triggerGuard(inst *provider.VultrInstance, guard *instanceGuard, cycle billing.Cycle, reason string) {
+	name := inst.Name
+	if bot.cfg.Vultr.GuardDryRun {
+		// 演练不影响正式的触发记录, 只在内存中记录已提醒的周期
+		if bot.guardRehearsed[name].Equal(cycle.Start) {
+			return
+		}
+		bot.guardRehearsed[name] = cycle.Start
+		log.Infof("guard triggered for Vultr instance %s (%s), dryRun=true: %s", name, inst.InstanceID, reason)
+		bot.notify(fmt.Sprintf("[流量保护演练] %s\n若关闭演练模式，将在 %s 后关闭该实例", reason, formatDuration(guard.Grace)))
+		return
+	}
+
+	// 大多数检查时已经触发过, 先只读判断, 避免每次检查都写入状态文件
+	handled := false
+	bot.state.View(func(d *state.Data) {
+		_, ok := d.GuardPending[name]
+		handled = ok || d.Guard[name].Equal(cycle.Start)
+	})
+	if handled {
+		return
+	}
+
+	pending := &state.GuardHalt{
+		Reason:     reason,
+		CycleStart: cycle.Start,
+		Deadline:   time.Now().Add(guard.Grace),
+	}
+	triggered := false
+	err := bot.state.Update(func(d *state.Data) {
+		if d.Guard[name].Equal(cycle.Start) {
+			return
+		}
+		if _, ok := d.GuardPending[name]; ok {
+			return
+		}
+		if d.GuardPending == nil {
+			d.GuardPending = make(map[string]*state.GuardHalt)
+		}
+		copied := *pending
+		d.GuardPending[name] = &copied
+		triggered = true
+	})
+	if err != nil {
+		log.Errorf("failed to save guard state, error: %+v", err)
+		return
+	}
+	if !triggered {
+		return
+	}
+
+	log.Infof("guard triggered for Vultr instance %s (%s): %s", name, inst.InstanceID, reason)
+	bot.scheduleGuardHalt(name, pending)
+}
+
+// restoreGuards 继续执行重启前未完成的流量保护关机.
+func (bot *Bot) restoreGuards() {
+	if bot.vultrProvider == nil {
+		return
+	}
+
+	pending := make(map[string]*state.GuardHalt)
+	bot.state.View(func(d *state.Data) {
+		for name, p := range d.GuardPending {
+			copied := *p
+			pending[name] = &copied
+		}
+	})
+	for name, p := range pending {
+		log.Infof("resuming guard of Vultr instance %s", name)
+		bot.scheduleGuardHalt(name, p)
+	}
+}
+
+// scheduleGuardHalt 请求管理员确认, 并在截止时间自动关机. 无法发送确认消息时直接在截止时间关机.
+func (bot *Bot) scheduleGuardHalt(name string, p *state.GuardHalt) {
+	wait := time.Until(p.Deadline)
+	if wait < 0 {
+		wait = 0
+	}
+	text := fmt.Sprintf("[流量保护] %s\n将在 %s 后自动关闭该实例", p.Reason, formatDuration(wait))
+
+	if len(bot.allowedRecipient) > 0 {
+		_, err := bot.askConfirm(recipient(bot.allowedRecipient), &confirmation{
+			Text:        text,
+			ConfirmText: "立即关机",
+			CancelText:  "取消关机",
+			TTL:         wait,
+			OnConfirm: func(msg *telebot.Message) {
+				bot.telebot.Edit(msg, text+"\n\n正在关机…")
+				bot.guardHalt(msg, name, p)
+			},
+			OnCancel: func(msg *telebot.Message) {
+				log.Infof("guard for Vultr instance %s cancelled", name)
+				bot.finishGuard(name, p, true)
+				bot.telebot.Edit(msg, text+"\n\n已取消，本计费周期内不再自动关机")
+			},
+			OnExpire: func(msg *telebot.Message) {
+				bot.telebot.Edit(msg, text+"\n\n正在关机…")
+				bot.guardHalt(msg, name, p)
+			},
+		})
+		if err == nil {
+			return
+		}
+		log.Errorf("failed to send guard confirmation, error: %+v", err)
+	}
+
+	log.Infof("no confirmation for guard, halting Vultr instance %s after %s", name, wait)
+	time.AfterFunc(wait, func() {
+		bot.guardHalt(nil, name, p)
+	})
+}
+
+// guardHalt 关闭名为 name 的实例, 实例重建后关闭新实例. msg 不为空时在该消息中显示结果, 否则发送通知.
+// 关机失败时清除等待状态, 下次检查时重新触发.
+func (bot *Bot) guardHalt(msg *telebot.Message, name string, p *state.GuardHalt) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	halt := bot.powerActions()["halt"]
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err == nil && inst == nil {
+		err = fmt.Errorf("instance not found")
+	}
+	if err == nil {
+		log.Infof("guard halting Vultr instance %s (%s)", inst.Name, inst.InstanceID)
+		err = halt.Do(ctx, inst.InstanceID)
+	}
+	if err != nil {
+		log.Errorf("failed to halt Vultr instance %s, error: %+v", name, err)
+		bot.finishGuard(name, p, false)
+		text := fmt.Sprintf("Opps，流量保护关闭 %s 失败", name)
+		if msg != nil {
+			bot.telebot.Edit(msg, text)
+		} else {
+			bot.notify(text)
+		}
+		return
+	}
+
+	bot.finishGuard(name, p, true)
+	if msg != nil {
+		go bot.watchPowerStatus(msg, halt, inst)
+	} else {
+		bot.notify(fmt.Sprintf("[流量保护] %s\n已关闭该实例", p.Reason))
+	}
+}
+
+// finishGuard 清除等待状态. done 为 true 时将该计费周期记为已触发.
+func (bot *Bot) finishGuard(name string, p *state.GuardHalt, done bool) {
+	err := bot.state.Update(func(d *state.Data) {
+		delete(d.GuardPending, name)
+		if !done {
+			return
+		}
+		if d.Guard == nil {
+			d.Guard = make(map[string]time.Time)
+		}
+		d.Guard[name] = p.CycleStart
+	})
+	if err != nil {
+		log.Errorf("failed to save guard state, error: %+v", err)
+	}
+}
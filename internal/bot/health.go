@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Health 检查所有服务是否可用.
+func (bot *Bot) Health(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	providers := bot.providers.Providers()
+	errs := make([]error, len(providers))
+
+	var wg sync.WaitGroup
+	for i := range providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = providers[i].Health(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	for i, p := range providers {
+		if errs[i] != nil {
+			log.Errorf("health check of %s failed, error: %+v", p.Name(), errs[i])
+			fmt.Fprintf(&b, "%s: ⚠️ 不可用\n", p.Title())
+			continue
+		}
+		fmt.Fprintf(&b, "%s: ✅ 正常\n", p.Title())
+	}
+	bot.telebot.Send(m.Chat, b.String())
+}
@@ -21,112 +21,80 @@ package bot
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"dlercloud-telegarm-bot/internal/bytesize"
 	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
 
 	"gopkg.in/tucnak/telebot.v2"
 )
 
 // Info 查询信息.
 func (bot *Bot) Info(m *telebot.Message) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	dlerInfo, err := bot.dler.GetUserInfo(ctx)
-	if err != nil {
-		log.Errorf("failed to get user info from Dler Cloud, error: %+v", err)
-		bot.telebot.Send(m.Chat, "Opps，查询失败")
-		return
+	targets := bot.collectUsage(ctx)
+	if _, err := bot.telebot.Send(m.Chat, bot.renderUsage(targets, nil), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown}); err != nil {
+		log.Errorf("failed to send usage, error: %+v", err)
 	}
-
-	if bot.vultrEnabled {
-		vultrInfo, err := bot.queryVultrInfo(ctx)
-		if err != nil {
-			log.Errorf("failed to get bandwidth info from Vultr, error: %+v", err)
-			bot.telebot.Send(m.Chat, "Opps，查询失败")
-			return
-		}
-
-		msg := fmt.Sprintf(`*Dler Cloud*
-已用流量: %s
-可用流量: %s
-
-`, dlerInfo.Used, dlerInfo.Unused)
-		for _, inst := range vultrInfo {
-			msg += fmt.Sprintf(`*%s*
-已用流量: %s
-可用流量: %s
-
-`, inst.Name, inst.Used, inst.Unused)
-		}
-
-		bot.telebot.Send(m.Chat, msg, &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
-		return
-	}
-
-	bot.telebot.Send(m.Chat, fmt.Sprintf("已用流量: %s\n可用流量: %s", dlerInfo.Used, dlerInfo.Unused))
 }
 
-func (bot *Bot) queryVultrInfo(ctx context.Context) ([]*vultrInstanceInfo, error) {
-	const (
-		dateFmt = "2006-01-02"
-	)
-
-	tz, err := time.LoadLocation("Asia/Shanghai")
-	if err != nil {
-		return nil, fmt.Errorf("failed to load timezone: %+v", err)
-	}
-	currentMonth := time.Now().In(tz).Month()
-
-	// 查询所有实例的流量总额
-	instances, err := bot.vultr.GetInstances(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query all instances: %+v", err)
-	}
-	totalGiBs := make(map[string]float64, len(instances))
-	for _, inst := range instances {
-		totalGiBs[inst.ID] = float64(inst.AllowedBandwidthGiB)
+// renderUsage 输出各对象的流量使用情况. prevUsed 不为空时同时输出与之相比的已用流量变化.
+func (bot *Bot) renderUsage(targets []*provider.Usage, prevUsed map[string]bytesize.Size) string {
+	pools := make(map[string]*provider.Usage)
+	for _, target := range targets {
+		pools[target.Key()] = target
 	}
 
-	ret := make([]*vultrInstanceInfo, 0, len(bot.vultrInstances))
-	for _, inst := range bot.vultrInstances {
-		if _, exist := totalGiBs[inst.InstanceID]; !exist {
-			return nil, fmt.Errorf("vultr instance %s not found in your account", inst.InstanceID)
+	var b strings.Builder
+	for _, target := range targets {
+		// 自动发现的实例以标签命名, 可能包含 Markdown 字符
+		name := escapeMarkdown(target.Name)
+		if target.Err != nil {
+			fmt.Fprintf(&b, "*%s*\n⚠️ 查询失败\n\n", name)
+			continue
 		}
 
-		bandwidth, err := bot.vultr.GetInstanceBandwidth(ctx, inst.InstanceID)
-		if err != nil {
-			return nil, err
+		used := bot.formatSize(target.Used)
+		if prev, ok := prevUsed[target.Key()]; ok {
+			if delta := target.Used - prev; delta >= 0 {
+				used += fmt.Sprintf("（+%s）", bot.formatSize(delta))
+			} else {
+				used += "（已重置）"
+			}
 		}
 
-		var usedBytes int64
-		for date, usage := range bandwidth {
-			d, err := time.Parse(dateFmt, date)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse date %s, error: %+v", date, err)
+		if len(target.Pool) > 0 {
+			fmt.Fprintf(&b, "*%s*\n已用流量: %s\n", name, used)
+			pool := pools[target.Provider+"/"+target.Pool]
+			if pool != nil && pool.Err == nil && pool.Used > 0 {
+				fmt.Fprintf(&b, "占%s已用流量: %.1f%%\n", escapeMarkdown(pool.Name), target.Used.Ratio(pool.Used)*100)
 			}
-			if d.Month() != currentMonth {
-				continue
-			}
-
-			usedBytes += usage.IncomingBytes + usage.OutgoingBytes
+		} else {
+			fmt.Fprintf(&b, "*%s*\n已用流量: %s\n可用流量: %s\n", name, used, bot.formatSize(target.Unused))
 		}
-
-		usedGiBs := float64(usedBytes) / (1024 * 1024 * 1024)
-		unusedGiB := totalGiBs[inst.InstanceID] - usedGiBs
-		ret = append(ret, &vultrInstanceInfo{
-			Name:   inst.Name,
-			Used:   fmt.Sprintf("%.2fGiB", usedGiBs),
-			Unused: fmt.Sprintf("%.2fGiB", unusedGiB),
-		})
+		if forecast := bot.renderForecast(target); len(forecast) > 0 {
+			fmt.Fprintf(&b, "%s\n", forecast)
+		}
+		if !target.ExpireAt.IsZero() {
+			fmt.Fprintf(&b, "到期时间: %s\n", target.ExpireAt.In(bot.location).Format("2006-01-02"))
+		}
+		b.WriteString("\n")
 	}
-
-	return ret, nil
+	return b.String()
 }
 
-type vultrInstanceInfo struct {
-	Name   string
-	Used   string
-	Unused string
+// collectUsage 查询所有服务的流量使用情况. 单个对象查询失败不影响其他对象.
+func (bot *Bot) collectUsage(ctx context.Context) []*provider.Usage {
+	usages := bot.providers.FetchUsage(ctx)
+	for _, usage := range usages {
+		if usage.Err != nil {
+			log.Errorf("failed to get usage of %s, error: %+v", usage.Key(), usage.Err)
+		}
+	}
+	bot.attachForecasts(usages)
+	return usages
 }
@@ -41,6 +41,10 @@ func Logger(update *telebot.Update) bool {
 		}
 		log.Infof("[Message updateID=%d] sender=%s, fromGroup=%v, recipient=%s, content=%s", update.ID, getSenderName(m.Sender), m.FromGroup(), m.Chat.Recipient(), m.Text)
 
+	case update.Callback != nil:
+		c := update.Callback
+		log.Infof("[Callback updateID=%d] sender=%s, data=%q", update.ID, getSenderName(c.Sender), c.Data)
+
 	default:
 		log.Infof("[Update updateID=%d] non-message update", update.ID)
 	}
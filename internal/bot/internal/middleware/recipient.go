@@ -19,18 +19,31 @@
 package middleware
 
 import (
+	"strings"
+
 	"dlercloud-telegarm-bot/internal/log"
 
 	"gopkg.in/tucnak/telebot.v2"
 )
 
-// FilterRecipient 限制消息来源中间件.
-func FilterRecipient(allowedRecipient string) func(*telebot.Update) bool {
+// FilterRecipient 限制消息来源中间件. 管理员在私聊中使用 privateEndpoints 中的命令或按钮时不受
+// allowedRecipient 限制, 例如不应在群组中发送的订阅链接.
+func FilterRecipient(allowedRecipient string, admins map[int64]bool, privateEndpoints map[string]bool) func(*telebot.Update) bool {
 	return func(update *telebot.Update) bool {
 		if update == nil {
 			return false
 		}
-		if update.Message == nil {
+
+		var (
+			chat   *telebot.Chat
+			sender *telebot.User
+		)
+		switch {
+		case update.Message != nil:
+			chat, sender = update.Message.Chat, update.Message.Sender
+		case update.Callback != nil && update.Callback.Message != nil:
+			chat, sender = update.Callback.Message.Chat, update.Callback.Sender
+		default:
 			log.Errorf("[Update updateID=%d] non-message update, ignore", update.ID)
 			return false
 		}
@@ -39,16 +52,34 @@ func FilterRecipient(allowedRecipient string) func(*telebot.Update) bool {
 			return true
 		}
 
-		m := update.Message
-		if m.Chat == nil {
+		if chat == nil {
 			log.Errorf("[Message updateID=%d] chat is nil", update.ID)
 			return false
 		}
-		if m.Chat.Recipient() != allowedRecipient {
-			log.Errorf("[Message updateID=%d] message from unallowed recipient %s, chatTitle=%s, sender=%s, ignore", update.ID, m.Chat.Recipient(), m.Chat.Title, getSenderName(m.Sender))
+		if chat.Type == telebot.ChatPrivate && sender != nil && admins[sender.ID] && privateEndpoints[endpoint(update)] {
+			return true
+		}
+		if chat.Recipient() != allowedRecipient {
+			log.Errorf("[Message updateID=%d] message from unallowed recipient %s, chatTitle=%s, sender=%s, ignore", update.ID, chat.Recipient(), chat.Title, getSenderName(sender))
 			return false
 		}
 
 		return true
 	}
 }
+
+// endpoint 返回消息中的命令 (例如 "/sub") 或回调按钮的 unique.
+func endpoint(update *telebot.Update) string {
+	if update.Message != nil {
+		fields := strings.Fields(update.Message.Text)
+		if len(fields) <= 0 || !strings.HasPrefix(fields[0], "/") {
+			return ""
+		}
+		// 群组中的命令可能带有 bot 用户名, 例如 "/sub@some_bot"
+		return strings.SplitN(fields[0], "@", 2)[0]
+	}
+
+	// 按钮的回调数据格式为 "\f<unique>|<data>"
+	data := strings.TrimPrefix(update.Callback.Data, "\f")
+	return strings.SplitN(data, "|", 2)[0]
+}
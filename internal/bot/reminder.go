@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/state"
+)
+
+const defaultReminderInterval = time.Hour
+
+var defaultExpiryDays = []int{7, 3, 1}
+
+// checkReminders 检查套餐到期和流量重置, 并向 allowedRecipient 发送提醒.
+func (bot *Bot) checkReminders() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := bot.dler.GetUserInfo(ctx)
+	if err != nil {
+		log.Errorf("failed to get user info from Dler Cloud for reminders, error: %+v", err)
+		return
+	}
+
+	var messages []string
+	err = bot.state.Update(func(d *state.Data) {
+		if msg := bot.checkPlanExpiry(info, d); len(msg) > 0 {
+			messages = append(messages, msg)
+		}
+		if msg := bot.checkTrafficReset(info, d); len(msg) > 0 {
+			messages = append(messages, msg)
+		}
+	})
+	if err != nil {
+		log.Errorf("failed to save reminder state, error: %+v", err)
+	}
+
+	for _, msg := range messages {
+		bot.notify(msg)
+	}
+}
+
+// checkPlanExpiry 返回需要发送的到期提醒, 每个提醒天数只发送一次.
+func (bot *Bot) checkPlanExpiry(info *dler.UserInfo, d *state.Data) string {
+	expiry, ok := info.PlanExpiry(bot.location)
+	if !ok {
+		return ""
+	}
+
+	// 续费后到期时间变化, 重新开始提醒
+	if d.Reminder.PlanTime != info.PlanTime {
+		d.Reminder.PlanTime = info.PlanTime
+		d.Reminder.SentDays = nil
+	}
+
+	days := int(math.Ceil(time.Until(expiry).Hours() / 24))
+	if days < 0 {
+		return ""
+	}
+
+	// 只发送最接近的一条提醒, 并将更早的提醒一并标记为已发送, 避免停机一段时间后连续发送
+	sent := make(map[int]bool, len(d.Reminder.SentDays))
+	for _, n := range d.Reminder.SentDays {
+		sent[n] = true
+	}
+	remind := false
+	for _, n := range bot.expiryDays {
+		if days <= n && !sent[n] {
+			remind = true
+			d.Reminder.SentDays = append(d.Reminder.SentDays, n)
+		}
+	}
+	sort.Ints(d.Reminder.SentDays)
+	if !remind {
+		return ""
+	}
+
+	return fmt.Sprintf("[到期提醒] Dler Cloud 套餐 %s 将于 %s 到期，剩余 %d 天", info.Plan, expiry.Format("2006-01-02"), days)
+}
+
+// checkTrafficReset 已用流量比上次查询时少, 说明流量已重置.
+func (bot *Bot) checkTrafficReset(info *dler.UserInfo, d *state.Data) string {
+	lastUsed := d.Reminder.LastUsed
+	d.Reminder.LastUsed = info.Used
+	if lastUsed <= 0 || info.Used >= lastUsed {
+		return ""
+	}
+
+	return fmt.Sprintf("[流量重置] Dler Cloud 流量已重置\n已用流量: %s\n可用流量: %s", bot.formatSize(info.Used), bot.formatSize(info.Unused))
+}
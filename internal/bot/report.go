@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/cron"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/state"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// report 定时发送的用量报告.
+type report struct {
+	id       string
+	schedule *cron.Schedule
+	location *time.Location
+	chats    []string
+}
+
+// startReports 按配置启动定时报告.
+func (bot *Bot) startReports() error {
+	for i, r := range bot.cfg.Reports {
+		schedule, err := cron.Parse(r.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule of report #%d: %+v", i+1, err)
+		}
+
+		location := bot.location
+		if len(r.Timezone) > 0 {
+			if location, err = time.LoadLocation(r.Timezone); err != nil {
+				return fmt.Errorf("invalid timezone of report #%d: %+v", i+1, err)
+			}
+		}
+
+		chats := r.Chats
+		if len(chats) <= 0 {
+			if len(bot.allowedRecipient) <= 0 {
+				return fmt.Errorf("no chats for report #%d", i+1)
+			}
+			chats = []string{bot.allowedRecipient}
+		}
+
+		rep := &report{
+			id:       strconv.Itoa(i + 1),
+			schedule: schedule,
+			location: location,
+			chats:    chats,
+		}
+		bot.runCron(schedule, location, func() { bot.sendReport(rep) })
+	}
+	return nil
+}
+
+func (bot *Bot) sendReport(rep *report) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	targets := bot.collectUsage(ctx)
+
+	var prevUsed map[string]bytesize.Size
+	err := bot.state.Update(func(d *state.Data) {
+		if d.Reports == nil {
+			d.Reports = make(map[string]map[string]bytesize.Size)
+		}
+		prevUsed = d.Reports[rep.id]
+
+		// 查询失败的对象保留上次的已用流量, 下次报告时仍可计算变化量
+		used := make(map[string]bytesize.Size, len(targets))
+		for _, target := range targets {
+			if target.Err != nil {
+				if prev, ok := prevUsed[target.Key()]; ok {
+					used[target.Key()] = prev
+				}
+				continue
+			}
+			used[target.Key()] = target.Used
+		}
+		d.Reports[rep.id] = used
+	})
+	if err != nil {
+		log.Errorf("failed to save report state, error: %+v", err)
+	}
+
+	msg := fmt.Sprintf("*用量报告* %s\n\n%s", time.Now().In(rep.location).Format("2006-01-02 15:04"), bot.renderUsage(targets, prevUsed))
+	for _, chat := range rep.chats {
+		if _, err := bot.telebot.Send(recipient(chat), msg, &telebot.SendOptions{ParseMode: telebot.ModeMarkdown}); err != nil {
+			log.Errorf("failed to send report #%s to %s, error: %+v", rep.id, chat, err)
+		}
+	}
+}
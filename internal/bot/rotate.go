@@ -0,0 +1,485 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/state"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	rotateConfirmTTL   = time.Minute
+	rotateBootInterval = 15 * time.Second
+	rotateBootTimeout  = 30 * time.Minute
+	rotateStepTimeout  = 30 * time.Second
+
+	// 重建时创建的快照的描述和新实例的标签前缀
+	rotateMarkerPrefix = "rotate:"
+)
+
+// 重建实例的步骤, 按执行顺序排列.
+const (
+	rotateSnapshot     = "snapshot"
+	rotateWaitSnapshot = "wait-snapshot"
+	rotateCreate       = "create"
+	rotateWaitBoot     = "wait-boot"
+	rotateSwitch       = "switch"
+	rotateDestroy      = "destroy"
+	rotateCleanup      = "cleanup"
+	rotateDone         = "done"
+
+	rotateRollback   = "rollback"
+	rotateRolledBack = "rolled-back"
+)
+
+// rotateStep 重建实例的一个步骤. Run 成功后进入下一个步骤.
+type rotateStep struct {
+	Name  string
+	Title string
+	// Rollback 失败时是否回滚. 旧实例删除后无法回滚, 之后的步骤失败只记录警告.
+	Rollback bool
+	// Timeout 步骤的超时时间, 为 0 时使用 rotateStepTimeout.
+	Timeout time.Duration
+	Run     func(ctx context.Context, name string, r *state.Rotation) error
+}
+
+func (bot *Bot) rotateSteps() []*rotateStep {
+	return []*rotateStep{
+		{Name: rotateSnapshot, Title: "创建快照", Rollback: true, Run: bot.rotateCreateSnapshot},
+		{Name: rotateWaitSnapshot, Title: "等待快照完成", Rollback: true, Timeout: snapshotTimeout + time.Minute, Run: bot.rotateWaitSnapshot},
+		{Name: rotateCreate, Title: "创建新实例", Rollback: true, Run: bot.rotateCreateInstance},
+		{Name: rotateWaitBoot, Title: "等待新实例启动", Rollback: true, Run: bot.rotateWaitBoot},
+		{Name: rotateSwitch, Title: "切换实例", Rollback: true, Run: bot.rotateSwitch},
+		{Name: rotateDestroy, Title: "删除旧实例", Run: bot.rotateDestroy},
+		{Name: rotateCleanup, Title: "删除快照", Run: bot.rotateCleanup},
+	}
+}
+
+// Rotate 从快照重建 Vultr 实例以更换 IP.
+//
+//	/rotate <实例名>
+func (bot *Bot) Rotate(m *telebot.Message) {
+	if bot.vultrProvider == nil {
+		bot.telebot.Send(m.Chat, "未启用 Vultr")
+		return
+	}
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以重建实例")
+		return
+	}
+
+	args := strings.Fields(m.Payload)
+	if len(args) != 1 {
+		bot.telebot.Send(m.Chat, "用法: /rotate <实例名>")
+		return
+	}
+	name := args[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if inst == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 不存在", name))
+		return
+	}
+	if bot.rotationOf(name) != nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 正在重建", name))
+		return
+	}
+
+	_, err = bot.askConfirm(m.Chat, &confirmation{
+		Text: fmt.Sprintf("确认重建实例 %s（%s）？\n将从快照创建相同地区和套餐的新实例，启动后删除旧实例。快照之后写入旧实例的数据会丢失。",
+			inst.Name, inst.Instance.MainIP),
+		TTL: rotateConfirmTTL,
+		OnConfirm: func(msg *telebot.Message) {
+			r := &state.Rotation{
+				Step:          rotateSnapshot,
+				OldInstanceID: inst.InstanceID,
+				OldIP:         inst.Instance.MainIP,
+				ChatID:        msg.Chat.ID,
+				MessageID:     strconv.Itoa(msg.ID),
+				StartedAt:     time.Now(),
+			}
+			started := false
+			err := bot.state.Update(func(d *state.Data) {
+				if d.Rotations == nil {
+					d.Rotations = make(map[string]*state.Rotation)
+				}
+				if _, exist := d.Rotations[name]; exist {
+					return
+				}
+				d.Rotations[name] = r
+				started = true
+			})
+			if err != nil {
+				log.Errorf("failed to save rotation state, error: %+v", err)
+				bot.telebot.Edit(msg, "Opps，保存状态失败")
+				return
+			}
+			if !started {
+				bot.telebot.Edit(msg, fmt.Sprintf("实例 %s 正在重建", name))
+				return
+			}
+
+			log.Infof("rotating Vultr instance %s (%s)", name, inst.InstanceID)
+			go bot.runRotation(name)
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to send confirmation, error: %+v", err)
+	}
+}
+
+// restoreRotations 应用重建后的实例 ID, 并继续执行重启前未完成的重建.
+func (bot *Bot) restoreRotations() {
+	if bot.vultrProvider == nil {
+		return
+	}
+
+	var names []string
+	bot.state.View(func(d *state.Data) {
+		for name, instanceID := range d.VultrInstances {
+			bot.vultrProvider.SetInstanceID(name, instanceID)
+		}
+		for name := range d.Rotations {
+			names = append(names, name)
+		}
+	})
+	for _, name := range names {
+		log.Infof("resuming rotation of Vultr instance %s", name)
+		go bot.runRotation(name)
+	}
+}
+
+// rotationOf 返回实例进行中的重建的副本, 没有时返回 nil.
+func (bot *Bot) rotationOf(name string) *state.Rotation {
+	var r *state.Rotation
+	bot.state.View(func(d *state.Data) {
+		if current, ok := d.Rotations[name]; ok {
+			copied := *current
+			r = &copied
+		}
+	})
+	return r
+}
+
+// saveRotation 保存重建进度, 并更新进度消息.
+func (bot *Bot) saveRotation(name string, r *state.Rotation) {
+	err := bot.state.Update(func(d *state.Data) {
+		if d.Rotations == nil {
+			d.Rotations = make(map[string]*state.Rotation)
+		}
+		copied := *r
+		d.Rotations[name] = &copied
+	})
+	if err != nil {
+		log.Errorf("failed to save rotation state, error: %+v", err)
+	}
+	bot.editRotation(name, r)
+}
+
+// runRotation 从保存的步骤开始执行重建, 直到完成或回滚结束.
+func (bot *Bot) runRotation(name string) {
+	r := bot.rotationOf(name)
+	if r == nil {
+		return
+	}
+	bot.editRotation(name, r)
+
+	steps := bot.rotateSteps()
+	for r.Step != rotateDone && r.Step != rotateRolledBack {
+		if r.Step == rotateRollback {
+			bot.rollbackRotation(name, r)
+			r.Step = rotateRolledBack
+			bot.saveRotation(name, r)
+			break
+		}
+
+		i := stepIndex(steps, r.Step)
+		if i < 0 {
+			log.Errorf("unknown rotation step %s of Vultr instance %s", r.Step, name)
+			r.FailedStep, r.Error, r.Step = r.Step, "未知步骤", rotateRollback
+			bot.saveRotation(name, r)
+			continue
+		}
+		step := steps[i]
+
+		timeout := step.Timeout
+		if timeout <= 0 {
+			timeout = rotateStepTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := step.Run(ctx, name, r)
+		cancel()
+
+		next := rotateDone
+		if i+1 < len(steps) {
+			next = steps[i+1].Name
+		}
+		switch {
+		case err == nil:
+			r.Step = next
+		case step.Rollback:
+			log.Errorf("rotation of Vultr instance %s failed at %s, error: %+v", name, step.Name, err)
+			r.FailedStep, r.Error, r.Step = step.Name, err.Error(), rotateRollback
+		default:
+			log.Errorf("rotation of Vultr instance %s: %s failed, error: %+v", name, step.Name, err)
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%s失败: %v", step.Title, err))
+			r.Step = next
+		}
+		bot.saveRotation(name, r)
+	}
+
+	err := bot.state.Update(func(d *state.Data) {
+		delete(d.Rotations, name)
+	})
+	if err != nil {
+		log.Errorf("failed to save rotation state, error: %+v", err)
+	}
+	log.Infof("rotation of Vultr instance %s finished at %s", name, r.Step)
+}
+
+func stepIndex(steps []*rotateStep, name string) int {
+	for i, step := range steps {
+		if step.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (bot *Bot) rotateCreateSnapshot(ctx context.Context, name string, r *state.Rotation) error {
+	description := rotationMarker(name, r)
+
+	// 重启前可能已经创建了快照但未保存
+	snapshots, err := bot.vultr.GetSnapshots(ctx)
+	if err != nil {
+		return fmt.Errorf("无法查询快照: %v", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Description == description {
+			r.SnapshotID = snapshot.ID
+			return nil
+		}
+	}
+
+	snapshot, err := bot.vultr.CreateSnapshot(ctx, r.OldInstanceID, description)
+	if err != nil {
+		return err
+	}
+	r.SnapshotID = snapshot.ID
+	return nil
+}
+
+func (bot *Bot) rotateWaitSnapshot(ctx context.Context, name string, r *state.Rotation) error {
+	_, err := bot.waitSnapshot(ctx, r.SnapshotID)
+	return err
+}
+
+func (bot *Bot) rotateCreateInstance(ctx context.Context, name string, r *state.Rotation) error {
+	old, err := bot.vultr.GetInstance(ctx, r.OldInstanceID)
+	if err != nil {
+		return fmt.Errorf("无法查询旧实例: %v", err)
+	}
+
+	// 重启前可能已经创建了实例但未保存, 按本次重建的标签查找
+	marker := rotationMarker(name, r)
+	instances, err := bot.vultr.GetInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("无法查询实例: %v", err)
+	}
+	for _, inst := range instances {
+		if inst.ID != old.ID && inst.HasTag(marker) {
+			r.NewInstanceID = inst.ID
+			return nil
+		}
+	}
+
+	// 不保留之前重建的标签
+	tags := []string{marker}
+	for _, tag := range old.Tags {
+		if !strings.HasPrefix(tag, rotateMarkerPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+
+	inst, err := bot.vultr.CreateInstance(ctx, &vultr.CreateInstanceRequest{
+		Region:          old.Region,
+		Plan:            old.Plan,
+		SnapshotID:      r.SnapshotID,
+		Label:           old.Label,
+		Hostname:        old.Hostname,
+		Tags:            tags,
+		EnableIPv6:      len(old.V6MainIP) > 0,
+		FirewallGroupID: old.FirewallGroupID,
+	})
+	if err != nil {
+		return err
+	}
+	r.NewInstanceID = inst.ID
+	return nil
+}
+
+// rotationMarker 返回本次重建的唯一标记, 用于在重启后找到已创建的快照和实例.
+func rotationMarker(name string, r *state.Rotation) string {
+	return fmt.Sprintf("%s%s:%d", rotateMarkerPrefix, name, r.StartedAt.Unix())
+}
+
+func (bot *Bot) rotateWaitBoot(ctx context.Context, name string, r *state.Rotation) error {
+	deadline := time.Now().Add(rotateBootTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(rotateBootInterval)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inst, err := bot.vultr.GetInstance(ctx, r.NewInstanceID)
+		cancel()
+		if err != nil {
+			log.Errorf("failed to query Vultr instance %s, error: %+v", r.NewInstanceID, err)
+			continue
+		}
+
+		if inst.Status == "active" && inst.PowerStatus == "running" && inst.ServerStatus == "ok" {
+			r.NewIP = inst.MainIP
+			return nil
+		}
+	}
+	return fmt.Errorf("新实例在 %s 内未启动", formatDuration(rotateBootTimeout))
+}
+
+func (bot *Bot) rotateSwitch(ctx context.Context, name string, r *state.Rotation) error {
+	err := bot.state.Update(func(d *state.Data) {
+		if d.VultrInstances == nil {
+			d.VultrInstances = make(map[string]string)
+		}
+		d.VultrInstances[name] = r.NewInstanceID
+	})
+	if err != nil {
+		return err
+	}
+	bot.vultrProvider.SetInstanceID(name, r.NewInstanceID)
+
+	// 立即将 DDNS 记录指向新实例
+	bot.syncDNS()
+	return nil
+}
+
+func (bot *Bot) rotateDestroy(ctx context.Context, name string, r *state.Rotation) error {
+	if err := bot.vultr.DeleteInstance(ctx, r.OldInstanceID); err != nil && !vultr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (bot *Bot) rotateCleanup(ctx context.Context, name string, r *state.Rotation) error {
+	if err := bot.vultr.DeleteSnapshot(ctx, r.SnapshotID); err != nil && !vultr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// rollbackRotation 删除重建过程中创建的实例和快照, 旧实例保持不变.
+func (bot *Bot) rollbackRotation(name string, r *state.Rotation) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// 切换之后的检查失败时已经保存了新实例 ID
+	switched := false
+	err := bot.state.Update(func(d *state.Data) {
+		if len(r.NewInstanceID) > 0 && d.VultrInstances[name] == r.NewInstanceID {
+			d.VultrInstances[name] = r.OldInstanceID
+			switched = true
+		}
+	})
+	if err != nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("恢复实例 ID 失败: %v", err))
+	}
+	if switched {
+		bot.vultrProvider.SetInstanceID(name, r.OldInstanceID)
+	}
+
+	if len(r.NewInstanceID) > 0 {
+		if err := bot.vultr.DeleteInstance(ctx, r.NewInstanceID); err != nil && !vultr.IsNotFound(err) {
+			log.Errorf("failed to delete Vultr instance %s during rollback, error: %+v", r.NewInstanceID, err)
+			r.Warnings = append(r.Warnings, fmt.Sprintf("删除新实例 %s 失败，请手动删除: %v", r.NewInstanceID, err))
+		}
+	}
+	if len(r.SnapshotID) > 0 {
+		if err := bot.vultr.DeleteSnapshot(ctx, r.SnapshotID); err != nil && !vultr.IsNotFound(err) {
+			log.Errorf("failed to delete Vultr snapshot %s during rollback, error: %+v", r.SnapshotID, err)
+			r.Warnings = append(r.Warnings, fmt.Sprintf("删除快照 %s 失败，请手动删除: %v", r.SnapshotID, err))
+		}
+	}
+}
+
+// editRotation 将进度消息编辑为当前进度.
+func (bot *Bot) editRotation(name string, r *state.Rotation) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "重建实例 %s（%s）\n", name, r.OldIP)
+
+	steps := bot.rotateSteps()
+	current := stepIndex(steps, r.Step)
+	if r.Step == rotateDone {
+		current = len(steps)
+	}
+	failed := stepIndex(steps, r.FailedStep)
+	for i, step := range steps {
+		mark := "⬜"
+		switch {
+		case failed >= 0 && i == failed:
+			mark = "❌"
+		case failed >= 0 && i < failed, current >= 0 && i < current:
+			mark = "✅"
+		case i == current:
+			mark = "⏳"
+		}
+		fmt.Fprintf(&b, "%s %s\n", mark, step.Title)
+	}
+
+	switch r.Step {
+	case rotateDone:
+		fmt.Fprintf(&b, "\n重建完成，新 IP: %s", r.NewIP)
+	case rotateRollback:
+		fmt.Fprintf(&b, "\n失败原因: %s\n正在回滚…", r.Error)
+	case rotateRolledBack:
+		fmt.Fprintf(&b, "\n失败原因: %s\n已回滚，旧实例保持不变", r.Error)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "\n⚠️ %s", warning)
+	}
+
+	msg := telebot.StoredMessage{MessageID: r.MessageID, ChatID: r.ChatID}
+	if _, err := bot.telebot.Edit(msg, b.String()); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		log.Errorf("failed to edit rotation message, error: %+v", err)
+	}
+}
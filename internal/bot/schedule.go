@@ -0,0 +1,96 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/cron"
+)
+
+// clock 一天中的某个时刻.
+type clock struct {
+	hour   int
+	minute int
+}
+
+// parseClock 解析 HH:MM 格式的时刻.
+func parseClock(s string) (clock, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return clock{}, fmt.Errorf("invalid clock %q, expecting HH:MM", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return clock{}, fmt.Errorf("invalid hour in clock %q", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return clock{}, fmt.Errorf("invalid minute in clock %q", s)
+	}
+	return clock{hour: hour, minute: minute}, nil
+}
+
+// next 返回 now 之后下一次到达该时刻的时间.
+func (c clock) next(now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), c.hour, c.minute, 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// runDaily 每天在 at 时刻 (bot 所在时区) 执行 fn, 不会阻塞.
+func (bot *Bot) runDaily(at clock, fn func()) {
+	go func() {
+		for {
+			now := time.Now().In(bot.location)
+			time.Sleep(at.next(now).Sub(now))
+			fn()
+		}
+	}()
+}
+
+// runEvery 每隔 interval 执行一次 fn, 启动时立即执行一次, 不会阻塞.
+func (bot *Bot) runEvery(interval time.Duration, fn func()) {
+	go func() {
+		for {
+			fn()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// runCron 按 cron 表达式在 location 时区执行 fn, 不会阻塞.
+func (bot *Bot) runCron(schedule *cron.Schedule, location *time.Location, fn func()) {
+	go func() {
+		for {
+			now := time.Now().In(location)
+			next := schedule.Next(now)
+			if next.IsZero() {
+				return
+			}
+			time.Sleep(next.Sub(now))
+			fn()
+		}
+	}()
+}
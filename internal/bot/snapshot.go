@@ -0,0 +1,288 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/cron"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	snapshotPollInterval = 30 * time.Second
+	snapshotTimeout      = 2 * time.Hour
+
+	// 定时快照的描述前缀, 只有带该前缀的快照会被自动清理
+	autoSnapshotPrefix = "auto:"
+)
+
+// Snapshot 查询或创建 Vultr 快照.
+//
+//	/snapshot
+//	/snapshot <实例名>
+func (bot *Bot) Snapshot(m *telebot.Message) {
+	if bot.vultrProvider == nil {
+		bot.telebot.Send(m.Chat, "未启用 Vultr")
+		return
+	}
+
+	args := strings.Fields(m.Payload)
+	switch len(args) {
+	case 0:
+		bot.listSnapshots(m)
+	case 1:
+		bot.manualSnapshot(m, args[0])
+	default:
+		bot.telebot.Send(m.Chat, "用法: /snapshot [实例名]")
+	}
+}
+
+func (bot *Bot) listSnapshots(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	snapshots, err := bot.vultr.GetSnapshots(ctx)
+	if err != nil {
+		log.Errorf("failed to get Vultr snapshots, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if len(snapshots) <= 0 {
+		bot.telebot.Send(m.Chat, "没有快照")
+		return
+	}
+	sortSnapshots(snapshots)
+
+	rows := [][]string{{"创建时间", "描述", "大小", "状态"}}
+	for _, snapshot := range snapshots {
+		rows = append(rows, []string{
+			snapshot.DateCreated.In(bot.location).Format("01-02 15:04"),
+			snapshot.Description,
+			bot.formatSize(snapshot.Size),
+			snapshot.Status,
+		})
+	}
+	var b strings.Builder
+	b.WriteString("```\n")
+	writeTable(&b, rows)
+	b.WriteString("```")
+	bot.telebot.Send(m.Chat, b.String(), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+}
+
+func (bot *Bot) manualSnapshot(m *telebot.Message, name string) {
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以创建快照")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if inst == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 不存在", name))
+		return
+	}
+
+	msg, err := bot.telebot.Send(m.Chat, fmt.Sprintf("正在为 %s 创建快照…", inst.Name))
+	if err != nil {
+		log.Errorf("failed to send message, error: %+v", err)
+		return
+	}
+
+	description := fmt.Sprintf("%s %s", inst.Name, time.Now().In(bot.location).Format("2006-01-02 15:04"))
+	snapshot, err := bot.vultr.CreateSnapshot(ctx, inst.InstanceID, description)
+	if err != nil {
+		log.Errorf("failed to create snapshot of Vultr instance %s, error: %+v", inst.InstanceID, err)
+		bot.telebot.Edit(msg, fmt.Sprintf("Opps，为 %s 创建快照失败", inst.Name))
+		return
+	}
+	log.Infof("created snapshot %s of Vultr instance %s (%s)", snapshot.ID, inst.Name, inst.InstanceID)
+	bot.telebot.Edit(msg, fmt.Sprintf("已开始为 %s 创建快照 %s，等待完成…", inst.Name, snapshot.ID))
+
+	go func() {
+		snapshot, err := bot.waitSnapshot(context.Background(), snapshot.ID)
+		if err != nil {
+			log.Errorf("snapshot %s of Vultr instance %s failed, error: %+v", snapshot.ID, inst.InstanceID, err)
+			bot.telebot.Edit(msg, fmt.Sprintf("%s 的快照 %s 失败: %v", inst.Name, snapshot.ID, err))
+			return
+		}
+		bot.telebot.Edit(msg, fmt.Sprintf("%s 的快照 %s 已完成，大小: %s", inst.Name, snapshot.ID, bot.formatSize(snapshot.Size)))
+	}()
+}
+
+// waitSnapshot 轮询快照状态直到创建完成或 ctx 结束, 返回最后一次查询到的快照.
+func (bot *Bot) waitSnapshot(ctx context.Context, snapshotID string) (*vultr.Snapshot, error) {
+	snapshot := &vultr.Snapshot{ID: snapshotID}
+	deadline := time.Now().Add(snapshotTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return snapshot, ctx.Err()
+		case <-time.After(snapshotPollInterval):
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		current, err := bot.vultr.GetSnapshot(reqCtx, snapshotID)
+		cancel()
+		if vultr.IsNotFound(err) {
+			// 快照创建失败后会被删除
+			return snapshot, fmt.Errorf("snapshot %s not found, creation may have failed", snapshotID)
+		}
+		if err != nil {
+			// 查询失败可能是暂时的, 继续等待直到超时
+			log.Errorf("failed to query Vultr snapshot %s, error: %+v", snapshotID, err)
+			continue
+		}
+
+		snapshot = current
+		switch current.Status {
+		case "complete":
+			return current, nil
+		case "pending":
+		default:
+			return current, fmt.Errorf("unexpected status %s", current.Status)
+		}
+	}
+	return snapshot, fmt.Errorf("timed out after %s", snapshotTimeout)
+}
+
+// startSnapshotSchedules 按配置启动各实例的定时快照.
+func (bot *Bot) startSnapshotSchedules() error {
+	if bot.vultrProvider == nil {
+		return nil
+	}
+	for name, inst := range bot.cfg.Vultr.Instances {
+		if len(inst.SnapshotSchedule) <= 0 {
+			continue
+		}
+		schedule, err := cron.Parse(inst.SnapshotSchedule)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot schedule of Vultr instance %s: %+v", name, err)
+		}
+
+		name, retention := name, inst.SnapshotRetention
+		bot.runCron(schedule, bot.location, func() { bot.scheduledSnapshot(name, retention) })
+	}
+	return nil
+}
+
+// scheduledSnapshot 为实例创建定时快照, 完成后只保留最近 retention 个定时快照.
+// retention 不大于 0 时不清理. 结果发送给管理员.
+func (bot *Bot) scheduledSnapshot(name string, retention int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err == nil && inst == nil {
+		err = fmt.Errorf("instance not found")
+	}
+	if err != nil {
+		cancel()
+		log.Errorf("failed to find Vultr instance %s for scheduled snapshot, error: %+v", name, err)
+		bot.notifyAdmins(fmt.Sprintf("[定时快照] %s 快照失败: 无法查询实例", name))
+		return
+	}
+
+	description := fmt.Sprintf("%s%s:%s", autoSnapshotPrefix, inst.Name, time.Now().In(bot.location).Format("2006-01-02 15:04"))
+	snapshot, err := bot.vultr.CreateSnapshot(ctx, inst.InstanceID, description)
+	cancel()
+	if err != nil {
+		log.Errorf("failed to create snapshot of Vultr instance %s, error: %+v", inst.InstanceID, err)
+		bot.notifyAdmins(fmt.Sprintf("[定时快照] %s 快照创建失败", inst.Name))
+		return
+	}
+	log.Infof("created scheduled snapshot %s of Vultr instance %s (%s)", snapshot.ID, inst.Name, inst.InstanceID)
+
+	snapshot, err = bot.waitSnapshot(context.Background(), snapshot.ID)
+	if err != nil {
+		log.Errorf("scheduled snapshot %s of Vultr instance %s failed, error: %+v", snapshot.ID, inst.InstanceID, err)
+		bot.notifyAdmins(fmt.Sprintf("[定时快照] %s 的快照 %s 失败: %v", inst.Name, snapshot.ID, err))
+		return
+	}
+	bot.notifyAdmins(fmt.Sprintf("[定时快照] %s 的快照 %s 已完成，大小: %s", inst.Name, snapshot.ID, bot.formatSize(snapshot.Size)))
+
+	if retention > 0 {
+		bot.pruneSnapshots(inst, retention)
+	}
+}
+
+// pruneSnapshots 删除实例超出保留数量的定时快照, 手动创建的快照不受影响.
+func (bot *Bot) pruneSnapshots(inst *provider.VultrInstance, retention int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	snapshots, err := bot.vultr.GetSnapshots(ctx)
+	if err != nil {
+		log.Errorf("failed to get Vultr snapshots for pruning, error: %+v", err)
+		bot.notifyAdmins(fmt.Sprintf("[定时快照] %s 的旧快照清理失败: 无法查询快照", inst.Name))
+		return
+	}
+
+	prefix := autoSnapshotPrefix + inst.Name + ":"
+	var owned []*vultr.Snapshot
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.Description, prefix) && snapshot.Status == "complete" {
+			owned = append(owned, snapshot)
+		}
+	}
+	if len(owned) <= retention {
+		return
+	}
+	sortSnapshots(owned)
+
+	var pruned, failed []string
+	for _, snapshot := range owned[retention:] {
+		if err := bot.vultr.DeleteSnapshot(ctx, snapshot.ID); err != nil {
+			log.Errorf("failed to delete Vultr snapshot %s, error: %+v", snapshot.ID, err)
+			failed = append(failed, snapshot.Description)
+			continue
+		}
+		log.Infof("deleted Vultr snapshot %s (%s)", snapshot.ID, snapshot.Description)
+		pruned = append(pruned, snapshot.Description)
+	}
+
+	msg := fmt.Sprintf("[定时快照] %s 保留最近 %d 个快照", inst.Name, retention)
+	if len(pruned) > 0 {
+		msg += fmt.Sprintf("\n已删除: %s", strings.Join(pruned, "，"))
+	}
+	if len(failed) > 0 {
+		msg += fmt.Sprintf("\n删除失败: %s", strings.Join(failed, "，"))
+	}
+	bot.notifyAdmins(msg)
+}
+
+// sortSnapshots 按创建时间倒序排列快照.
+func sortSnapshots(snapshots []*vultr.Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].DateCreated.After(snapshots[j].DateCreated.Time)
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/log"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	subButtonUnique       = "sub"
+	defaultSubDeleteAfter = time.Minute
+)
+
+// Sub 查询托管订阅链接. 订阅链接属于敏感信息, 仅允许管理员在私聊中使用.
+func (bot *Bot) Sub(m *telebot.Message) {
+	if !m.Private() || !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "该命令仅限管理员私聊使用")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := bot.dler.GetSubscription(ctx)
+	if err != nil {
+		log.Errorf("failed to get subscription from Dler Cloud, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+
+	links := sub.Links()
+	if len(links) <= 0 {
+		bot.telebot.Send(m.Chat, "没有可用的订阅链接")
+		return
+	}
+
+	markup := new(telebot.ReplyMarkup)
+	rows := make([]telebot.Row, 0, len(links))
+	for _, link := range links {
+		rows = append(rows, markup.Row(markup.Data(link.Protocol, subButtonUnique, link.Protocol)))
+	}
+	markup.Inline(rows...)
+
+	msg, err := bot.telebot.Send(m.Chat, bot.subHint("请选择订阅类型"), markup)
+	if err != nil {
+		log.Errorf("failed to send subscription menu, error: %+v", err)
+		return
+	}
+	bot.deleteAfter(msg, bot.subDeleteAfter)
+}
+
+func (bot *Bot) onSubSelected(c *telebot.Callback) {
+	defer bot.telebot.Respond(c)
+
+	if c.Message == nil || !c.Message.Private() || !bot.isAdmin(c.Sender) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := bot.dler.GetSubscription(ctx)
+	if err != nil {
+		log.Errorf("failed to get subscription from Dler Cloud, error: %+v", err)
+		bot.telebot.Edit(c.Message, "Opps，查询失败")
+		return
+	}
+
+	for _, link := range sub.Links() {
+		if link.Protocol != c.Data {
+			continue
+		}
+		msg := fmt.Sprintf("*%s*\n`%s`\n\n%s", link.Protocol, link.URL, bot.subHint(""))
+		bot.telebot.Edit(c.Message, msg, &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+		return
+	}
+	bot.telebot.Edit(c.Message, fmt.Sprintf("订阅类型 %s 不存在", c.Data))
+}
+
+func (bot *Bot) subHint(prefix string) string {
+	hint := fmt.Sprintf("（本消息将在 %s 后删除）", formatDuration(bot.subDeleteAfter))
+	if len(prefix) <= 0 {
+		return hint
+	}
+	return prefix + hint
+}
+
+// deleteAfter 在 d 时间后删除消息.
+func (bot *Bot) deleteAfter(msg *telebot.Message, d time.Duration) {
+	time.AfterFunc(d, func() {
+		if err := bot.telebot.Delete(msg); err != nil {
+			log.Errorf("failed to delete message %d, error: %+v", msg.ID, err)
+		}
+	})
+}
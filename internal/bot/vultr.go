@@ -0,0 +1,207 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	powerConfirmTTL   = 30 * time.Second
+	powerPollInterval = 5 * time.Second
+	powerPollTimeout  = 5 * time.Minute
+)
+
+// powerAction 实例电源操作.
+type powerAction struct {
+	Name        string
+	Title       string
+	Destructive bool
+	Expected    string        // 操作完成后实例的 power_status
+	MinWait     time.Duration // 至少等待的时间, 用于状态不会明显变化的操作 (重启)
+	Do          func(ctx context.Context, instanceID string) error
+}
+
+// reached 返回实例是否已达到操作的预期状态.
+func (a *powerAction) reached(inst *vultr.Instance) bool {
+	if inst.PowerStatus != a.Expected {
+		return false
+	}
+	// 关机后 server_status 不一定为 ok
+	return a.Expected == "stopped" || inst.ServerStatus == "ok"
+}
+
+func (bot *Bot) powerActions() map[string]*powerAction {
+	halt := &powerAction{Name: "halt", Title: "关机", Destructive: true, Expected: "stopped", Do: bot.vultr.HaltInstance}
+	return map[string]*powerAction{
+		"start":  {Name: "start", Title: "开机", Expected: "running", Do: bot.vultr.StartInstance},
+		"reboot": {Name: "reboot", Title: "重启", Destructive: true, Expected: "running", MinWait: 30 * time.Second, Do: bot.vultr.RebootInstance},
+		"halt":   halt,
+		"stop":   halt, // Vultr 没有单独的 stop 操作, 与 halt 相同
+	}
+}
+
+const vultrUsage = `用法:
+/vultr usage <实例名>
+/vultr pool
+/vultr start|stop|reboot|halt <实例名>`
+
+// Vultr 管理 Vultr 实例.
+//
+//	/vultr usage <实例名>
+//	/vultr pool
+//	/vultr start|stop|reboot|halt <实例名>
+func (bot *Bot) Vultr(m *telebot.Message) {
+	if bot.vultrProvider == nil {
+		bot.telebot.Send(m.Chat, "未启用 Vultr")
+		return
+	}
+
+	args := strings.Fields(m.Payload)
+	if len(args) <= 0 {
+		bot.telebot.Send(m.Chat, vultrUsage)
+		return
+	}
+
+	if args[0] == "pool" {
+		bot.vultrPool(m)
+		return
+	}
+	if args[0] == "usage" {
+		if len(args) != 2 {
+			bot.telebot.Send(m.Chat, vultrUsage)
+			return
+		}
+		bot.vultrBandwidth(m, args[1])
+		return
+	}
+	if action, ok := bot.powerActions()[args[0]]; ok {
+		if len(args) != 2 {
+			bot.telebot.Send(m.Chat, vultrUsage)
+			return
+		}
+		bot.vultrPower(m, action, args[1])
+		return
+	}
+	bot.telebot.Send(m.Chat, vultrUsage)
+}
+
+// findVultrInstance 按名称查找实例.
+func (bot *Bot) findVultrInstance(ctx context.Context, name string) (*provider.VultrInstance, error) {
+	instances, err := bot.vultrProvider.ResolveInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range instances {
+		if inst.Name == name && inst.Instance != nil {
+			return inst, nil
+		}
+	}
+	return nil, nil
+}
+
+func (bot *Bot) vultrPower(m *telebot.Message, action *powerAction, name string) {
+	if !bot.isAdmin(m.Sender) {
+		bot.telebot.Send(m.Chat, "仅管理员可以操作实例")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if inst == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 不存在", name))
+		return
+	}
+
+	if !action.Destructive {
+		msg, err := bot.telebot.Send(m.Chat, fmt.Sprintf("正在%s %s…", action.Title, inst.Name))
+		if err != nil {
+			log.Errorf("failed to send message, error: %+v", err)
+			return
+		}
+		bot.doPowerAction(msg, action, inst)
+		return
+	}
+
+	_, err = bot.askConfirm(m.Chat, &confirmation{
+		Text: fmt.Sprintf("确认%s实例 %s（%s）？当前状态: %s", action.Title, inst.Name, inst.Instance.MainIP, inst.Instance.PowerStatus),
+		TTL:  powerConfirmTTL,
+		OnConfirm: func(msg *telebot.Message) {
+			bot.telebot.Edit(msg, fmt.Sprintf("正在%s %s…", action.Title, inst.Name))
+			bot.doPowerAction(msg, action, inst)
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to send confirmation, error: %+v", err)
+	}
+}
+
+// doPowerAction 执行电源操作, 并在实例状态变化后编辑消息.
+func (bot *Bot) doPowerAction(msg *telebot.Message, action *powerAction, inst *provider.VultrInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	log.Infof("%s Vultr instance %s (%s)", action.Name, inst.Name, inst.InstanceID)
+	if err := action.Do(ctx, inst.InstanceID); err != nil {
+		log.Errorf("failed to %s Vultr instance %s, error: %+v", action.Name, inst.InstanceID, err)
+		bot.telebot.Edit(msg, fmt.Sprintf("Opps，%s %s 失败", action.Title, inst.Name))
+		return
+	}
+
+	go bot.watchPowerStatus(msg, action, inst)
+}
+
+// watchPowerStatus 轮询实例状态, 直到实例达到预期状态或超时.
+func (bot *Bot) watchPowerStatus(msg *telebot.Message, action *powerAction, inst *provider.VultrInstance) {
+	start := time.Now()
+	deadline := start.Add(powerPollTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(powerPollInterval)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		current, err := bot.vultr.GetInstance(ctx, inst.InstanceID)
+		cancel()
+		if err != nil {
+			log.Errorf("failed to query Vultr instance %s, error: %+v", inst.InstanceID, err)
+			continue
+		}
+
+		if action.reached(current) && time.Since(start) >= action.MinWait {
+			bot.telebot.Edit(msg, fmt.Sprintf("%s %s 完成，当前状态: %s", inst.Name, action.Title, current.PowerStatus))
+			return
+		}
+	}
+	bot.telebot.Edit(msg, fmt.Sprintf("已发送%s指令，但 %s 在 %s 内未达到预期状态", action.Title, inst.Name, formatDuration(powerPollTimeout)))
+}
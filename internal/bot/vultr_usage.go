@@ -0,0 +1,208 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/log"
+	"dlercloud-telegarm-bot/internal/provider"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+var directionTitles = map[provider.Direction]string{
+	provider.DirectionBoth:     "双向",
+	provider.DirectionOutgoing: "出站",
+	provider.DirectionIncoming: "入站",
+}
+
+// vultrBandwidth 输出实例本计费周期内每天各方向的带宽使用情况.
+func (bot *Bot) vultrBandwidth(m *telebot.Message, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst, err := bot.findVultrInstance(ctx, name)
+	if err != nil {
+		log.Errorf("failed to query Vultr instances, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+	if inst == nil {
+		bot.telebot.Send(m.Chat, fmt.Sprintf("实例 %s 不存在", name))
+		return
+	}
+
+	cycle := bot.vultrProvider.Cycle(time.Now())
+	daily, err := bot.vultrProvider.DailyBandwidth(ctx, inst.InstanceID, cycle)
+	if err != nil {
+		log.Errorf("failed to get bandwidth of Vultr instance %s, error: %+v", inst.InstanceID, err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+
+	var (
+		rows                        = [][]string{{"日期", "入站", "出站", "合计"}}
+		incoming, outgoing, counted bytesize.Size
+	)
+	for _, d := range daily {
+		rows = append(rows, []string{
+			d.Date.Format("01-02"),
+			bot.formatSize(d.Incoming),
+			bot.formatSize(d.Outgoing),
+			bot.formatSize(d.Total()),
+		})
+		incoming += d.Incoming
+		outgoing += d.Outgoing
+		counted += d.Counted(inst.Counted)
+	}
+	rows = append(rows, []string{
+		"合计",
+		bot.formatSize(incoming),
+		bot.formatSize(outgoing),
+		bot.formatSize(incoming + outgoing),
+	})
+
+	allowance := inst.Instance.AllowedBandwidth()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* 本周期（%s 起）带宽\n", escapeMarkdown(inst.Name), cycle.Start.Format("2006-01-02"))
+	b.WriteString("```\n")
+	writeTable(&b, rows)
+	b.WriteString("```\n")
+	if bot.vultrProvider.Pooled() {
+		fmt.Fprintf(&b, "计入共享额度（出站）: %s", bot.formatSize(outgoing))
+	} else {
+		fmt.Fprintf(&b, "计入额度（%s）: %s / %s\n", directionTitles[inst.Counted], bot.formatSize(counted), bot.formatSize(allowance))
+		fmt.Fprintf(&b, "可用流量: %s", bot.formatSize(allowance-counted))
+	}
+
+	if _, err := bot.telebot.Send(m.Chat, b.String(), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown}); err != nil {
+		log.Errorf("failed to send Vultr usage, error: %+v", err)
+	}
+}
+
+// vultrPool 输出账户共享带宽的使用情况. 共享带宽模式下同时输出各实例本月贡献的出站流量.
+func (bot *Bot) vultrPool(m *telebot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bandwidth, err := bot.vultrProvider.AccountBandwidth(ctx)
+	if err != nil {
+		log.Errorf("failed to get Vultr account bandwidth, error: %+v", err)
+		bot.telebot.Send(m.Chat, "Opps，查询失败")
+		return
+	}
+
+	var b strings.Builder
+	bot.writeBandwidthPeriod(&b, "本月至今", &bandwidth.CurrentMonthToDate)
+	bot.writeBandwidthPeriod(&b, "本月预计", &bandwidth.CurrentMonthProjected)
+	bot.writeBandwidthPeriod(&b, "上月", &bandwidth.PreviousMonth)
+
+	if bot.vultrProvider.Pooled() {
+		usages := bot.vultrProvider.FetchUsage(ctx)
+		var pool *provider.Usage
+		for _, usage := range usages {
+			if len(usage.Pool) <= 0 {
+				pool = usage
+				break
+			}
+		}
+
+		rows := [][]string{{"实例", "出站", "占比"}}
+		for _, usage := range usages {
+			if len(usage.Pool) <= 0 {
+				continue
+			}
+			if usage.Err != nil {
+				rows = append(rows, []string{usage.Name, "查询失败", ""})
+				continue
+			}
+			share := ""
+			if pool != nil && pool.Err == nil {
+				share = fmt.Sprintf("%.1f%%", usage.Used.Ratio(pool.Used)*100)
+			}
+			rows = append(rows, []string{usage.Name, bot.formatSize(usage.Used), share})
+		}
+		if len(rows) > 1 {
+			b.WriteString("*各实例本月出站流量*\n```\n")
+			writeTable(&b, rows)
+			b.WriteString("```\n")
+		}
+	}
+
+	if _, err := bot.telebot.Send(m.Chat, b.String(), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown}); err != nil {
+		log.Errorf("failed to send Vultr usage, error: %+v", err)
+	}
+}
+
+func (bot *Bot) writeBandwidthPeriod(b *strings.Builder, title string, period *vultr.BandwidthPeriod) {
+	fmt.Fprintf(b, "*%s*（%s 至 %s）\n", title,
+		period.Start.In(bot.location).Format("01-02"), period.End.In(bot.location).Format("01-02"))
+	fmt.Fprintf(b, "出站流量: %s / %s\n", bot.formatSize(period.Outgoing()), bot.formatSize(period.Credits()))
+	fmt.Fprintf(b, "入站流量: %s\n", bot.formatSize(period.Incoming()))
+	if period.Overage > 0 {
+		fmt.Fprintf(b, "超额流量: %s，费用: $%.2f\n", bot.formatSize(period.OverageBandwidth()), period.OverageCost)
+	}
+	b.WriteString("\n")
+}
+
+// writeTable 输出右对齐的等宽表格, 第一列左对齐.
+func writeTable(b *strings.Builder, rows [][]string) {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := displayWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	for _, row := range rows {
+		for i, cell := range row {
+			pad := strings.Repeat(" ", widths[i]-displayWidth(cell))
+			if i == 0 {
+				b.WriteString(cell + pad)
+			} else {
+				b.WriteString("  " + pad + cell)
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+// displayWidth 返回字符串在等宽字体中的显示宽度, 中文字符占两列.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
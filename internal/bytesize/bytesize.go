@@ -0,0 +1,207 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bytesize
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Size 以字节为单位的数据量, 可以为负数 (例如超额使用后的剩余流量).
+type Size int64
+
+// 十进制单位.
+const (
+	B  Size = 1
+	KB Size = 1000 * B
+	MB Size = 1000 * KB
+	GB Size = 1000 * MB
+	TB Size = 1000 * GB
+	PB Size = 1000 * TB
+)
+
+// 二进制单位.
+const (
+	KiB Size = 1024 * B
+	MiB Size = 1024 * KiB
+	GiB Size = 1024 * MiB
+	TiB Size = 1024 * GiB
+	PiB Size = 1024 * TiB
+)
+
+// System 单位制.
+type System int
+
+const (
+	// Binary 二进制单位制, 以 1024 进位, 单位为 KiB/MiB/GiB/TiB/PiB.
+	Binary System = iota
+	// Decimal 十进制单位制, 以 1000 进位, 单位为 KB/MB/GB/TB/PB.
+	Decimal
+)
+
+// ParseSystem 解析单位制名称, 空字符串表示二进制单位制.
+func ParseSystem(s string) (System, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "binary", "iec":
+		return Binary, nil
+	case "decimal", "si":
+		return Decimal, nil
+	default:
+		return Binary, fmt.Errorf("unknown unit system %q", s)
+	}
+}
+
+type unit struct {
+	name string
+	size Size
+}
+
+var units = map[System][]unit{
+	Binary:  {{"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB}},
+	Decimal: {{"PB", PB}, {"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB}},
+}
+
+var (
+	sizeRegexp      = regexp.MustCompile(`^([+-]?[0-9]*\.?[0-9]+)\s*([KMGTPkmgtp]?)(i?)([Bb]?)$`)
+	thousandsRegexp = regexp.MustCompile(`^[+-]?[0-9]{1,3}(,[0-9]{3})+(\.[0-9]+)?`)
+)
+
+// Parse 解析 "12.34GB", "512 MiB", "1.5T", "100B", "1,024.00 GB" 等格式的数据量.
+//
+// 带 i 的单位 (KiB/MiB/GiB/TiB/PiB) 总是按二进制解析; 不带 i 的单位 (KB/MB/GB/TB/PB)
+// 含义因服务而异, 按 legacy 指定的单位制解析.
+func Parse(s string, legacy System) (Size, error) {
+	normalized := strings.TrimSpace(s)
+	// 去掉千位分隔符
+	if number := thousandsRegexp.FindString(normalized); len(number) > 0 {
+		normalized = strings.ReplaceAll(number, ",", "") + normalized[len(number):]
+	}
+
+	match := sizeRegexp.FindStringSubmatch(normalized)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %+v", s, err)
+	}
+
+	prefix, binary := strings.ToUpper(match[2]), match[3] == "i"
+	if len(prefix) <= 0 {
+		if binary {
+			return 0, fmt.Errorf("invalid size %q", s)
+		}
+		return Size(math.Round(value)), nil
+	}
+
+	base := 1000.0
+	if binary || legacy == Binary {
+		base = 1024
+	}
+	exp := strings.Index("KMGTP", prefix) + 1
+	return Size(math.Round(value * math.Pow(base, float64(exp)))), nil
+}
+
+// Format 按指定单位制格式化, 保留两位小数, 例如 "12.34 GiB".
+func (s Size) Format(system System) string {
+	abs := s
+	if abs < 0 {
+		abs = -abs
+	}
+	for _, u := range units[system] {
+		if abs >= u.size {
+			return fmt.Sprintf("%.2f %s", float64(s)/float64(u.size), u.name)
+		}
+	}
+	return fmt.Sprintf("%d B", int64(s))
+}
+
+// String 按二进制单位制格式化.
+func (s Size) String() string {
+	return s.Format(Binary)
+}
+
+// GiB 返回以 GiB 为单位的数值.
+func (s Size) GiB() float64 {
+	return float64(s) / float64(GiB)
+}
+
+// Add 返回 s + other.
+func (s Size) Add(other Size) Size {
+	return s + other
+}
+
+// Sub 返回 s - other.
+func (s Size) Sub(other Size) Size {
+	return s - other
+}
+
+// Ratio 返回 s 占 total 的比例. total 不为正数时返回 0.
+func (s Size) Ratio(total Size) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(s) / float64(total)
+}
+
+// Sum 返回所有数据量之和.
+func Sum(sizes ...Size) Size {
+	var ret Size
+	for _, size := range sizes {
+		ret += size
+	}
+	return ret
+}
+
+// UnmarshalJSON 支持字节数 (数字) 和 Parse 支持的字符串格式.
+// 字符串中不带 i 的单位按二进制解析, 空字符串视为 0.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		v, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid size %s: %+v", data, err)
+		}
+		*s = Size(math.Round(v))
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("invalid size %s: %+v", data, err)
+	}
+	if len(strings.TrimSpace(str)) <= 0 {
+		*s = 0
+		return nil
+	}
+	v, err := Parse(str, Binary)
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
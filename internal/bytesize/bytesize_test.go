@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package bytesize
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		legacy  System
+		want    Size
+		wantErr bool
+	}{
+		// Dler Cloud 接口返回的格式
+		{s: "12.34GB", legacy: Binary, want: 13249974108},
+		{s: "512 MB", legacy: Binary, want: 512 * MiB},
+		{s: "1.5T", legacy: Binary, want: TiB + TiB/2},
+		{s: "100B", legacy: Binary, want: 100},
+		{s: "0B", legacy: Binary, want: 0},
+		{s: "1,024.00GB", legacy: Binary, want: 1024 * GiB},
+		{s: "1PB", legacy: Binary, want: PiB},
+
+		// 空格
+		{s: "512MB", legacy: Binary, want: 512 * MiB},
+		{s: "  512  MB ", legacy: Binary, want: 512 * MiB},
+		{s: "100", legacy: Binary, want: 100},
+
+		// 单位制
+		{s: "1GB", legacy: Decimal, want: GB},
+		{s: "1 GiB", legacy: Decimal, want: GiB},
+		{s: "1gb", legacy: Decimal, want: GB},
+		{s: "1.5 TB", legacy: Decimal, want: TB + TB/2},
+		{s: "2 KiB", legacy: Binary, want: 2 * KiB},
+
+		// 负数
+		{s: "-1.5GB", legacy: Binary, want: -(GiB + GiB/2)},
+
+		// 错误的格式
+		{s: "", wantErr: true},
+		{s: "GB", wantErr: true},
+		{s: "无限", wantErr: true},
+		{s: "1.2.3GB", wantErr: true},
+		{s: "1 XB", wantErr: true},
+		{s: "1iB", wantErr: true},
+		{s: "1,02GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.s, tt.legacy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %d, want error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		size   Size
+		system System
+		want   string
+	}{
+		{size: 0, system: Binary, want: "0 B"},
+		{size: 1023, system: Binary, want: "1023 B"},
+		{size: 1536 * MiB, system: Binary, want: "1.50 GiB"},
+		{size: 1500 * MB, system: Decimal, want: "1.50 GB"},
+		{size: -2 * TiB, system: Binary, want: "-2.00 TiB"},
+		{size: 2 * PiB, system: Binary, want: "2.00 PiB"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.size.Format(tt.system); got != tt.want {
+			t.Errorf("Size(%d).Format() = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    Size
+		wantErr bool
+	}{
+		{data: `1073741824`, want: GiB},
+		{data: `1.5e3`, want: 1500},
+		{data: `"12.34GB"`, want: 13249974108},
+		{data: `"1,024.00GB"`, want: 1024 * GiB},
+		{data: `""`, want: 0},
+		{data: `null`, want: 0},
+		{data: `"无限"`, wantErr: true},
+		{data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got Size
+		err := json.Unmarshal([]byte(tt.data), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %d, want error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) error: %v", tt.data, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Bar 一天的数据.
+type Bar struct {
+	Label    string  // 显示在横轴下方, 例如 "05"
+	Incoming float64 // 入站
+	Outgoing float64 // 出站
+	// Cumulative 本周期截至当天的累计用量, 小于 0 时不绘制 (例如不在本周期内的日期).
+	Cumulative float64
+}
+
+// Options 图表选项.
+type Options struct {
+	Width  int
+	Height int
+	// Allowance 流量额度, 与累计曲线共用右侧纵轴, 不大于 0 时不绘制.
+	Allowance float64
+	// FormatValue 格式化纵轴刻度.
+	FormatValue func(v float64) string
+}
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	colorText       = color.RGBA{0x30, 0x30, 0x30, 0xff}
+	colorIncoming   = color.RGBA{0x4c, 0x8b, 0xf5, 0xff}
+	colorOutgoing   = color.RGBA{0xf5, 0x9e, 0x4c, 0xff}
+	colorCumulative = color.RGBA{0x2e, 0xa0, 0x4f, 0xff}
+	colorAllowance  = color.RGBA{0xd9, 0x3b, 0x3b, 0xff}
+)
+
+const (
+	marginLeft   = 90
+	marginRight  = 90
+	marginTop    = 20
+	marginBottom = 40
+	gridLines    = 4
+)
+
+// Bandwidth 绘制每日带宽柱状图. 每天的入站和出站流量堆叠显示, 使用左侧纵轴;
+// 累计用量曲线和流量额度线使用右侧纵轴.
+func Bandwidth(bars []Bar, opts Options) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{colorBackground}, image.Point{}, draw.Src)
+
+	plot := image.Rect(marginLeft, marginTop, opts.Width-marginRight, opts.Height-marginBottom)
+	if plot.Dx() <= 0 || plot.Dy() <= 0 || len(bars) <= 0 {
+		return img
+	}
+
+	var dailyMax, cumulativeMax float64
+	for _, bar := range bars {
+		dailyMax = math.Max(dailyMax, bar.Incoming+bar.Outgoing)
+		cumulativeMax = math.Max(cumulativeMax, bar.Cumulative)
+	}
+	cumulativeMax = math.Max(cumulativeMax, opts.Allowance)
+	dailyMax = niceCeil(dailyMax)
+	cumulativeMax = niceCeil(cumulativeMax)
+
+	// 网格线和刻度
+	for i := 0; i <= gridLines; i++ {
+		y := plot.Max.Y - plot.Dy()*i/gridLines
+		hLine(img, plot.Min.X, plot.Max.X, y, colorGrid)
+		if opts.FormatValue != nil {
+			left := opts.FormatValue(dailyMax * float64(i) / gridLines)
+			drawText(img, plot.Min.X-6-textWidth(left), y-textHeight/2, left, colorText)
+			if cumulativeMax > 0 {
+				right := opts.FormatValue(cumulativeMax * float64(i) / gridLines)
+				drawText(img, plot.Max.X+6, y-textHeight/2, right, colorText)
+			}
+		}
+	}
+
+	// 柱状图
+	slot := float64(plot.Dx()) / float64(len(bars))
+	barWidth := int(math.Max(1, slot*0.7))
+	labelEvery := int(math.Ceil(float64(textWidth("00")+4) / slot))
+	scaleY := func(v float64, max float64) int {
+		if max <= 0 {
+			return plot.Max.Y
+		}
+		return plot.Max.Y - int(math.Round(v/max*float64(plot.Dy())))
+	}
+	for i, bar := range bars {
+		x0 := plot.Min.X + int(slot*float64(i)+(slot-float64(barWidth))/2)
+		x1 := x0 + barWidth
+		yIn := scaleY(bar.Incoming, dailyMax)
+		yOut := scaleY(bar.Incoming+bar.Outgoing, dailyMax)
+		fillRect(img, image.Rect(x0, yIn, x1, plot.Max.Y), colorIncoming)
+		fillRect(img, image.Rect(x0, yOut, x1, yIn), colorOutgoing)
+
+		if i%labelEvery == 0 {
+			center := plot.Min.X + int(slot*(float64(i)+0.5))
+			drawText(img, center-textWidth(bar.Label)/2, plot.Max.Y+8, bar.Label, colorText)
+		}
+	}
+
+	// 流量额度线
+	if opts.Allowance > 0 {
+		y := scaleY(opts.Allowance, cumulativeMax)
+		for x := plot.Min.X; x < plot.Max.X; x += 8 {
+			hLine(img, x, minInt(x+5, plot.Max.X), y, colorAllowance)
+			hLine(img, x, minInt(x+5, plot.Max.X), y+1, colorAllowance)
+		}
+	}
+
+	// 累计用量曲线
+	prevX, prevY := -1, -1
+	for i, bar := range bars {
+		if bar.Cumulative < 0 {
+			prevX, prevY = -1, -1
+			continue
+		}
+		x := plot.Min.X + int(slot*(float64(i)+0.5))
+		y := scaleY(bar.Cumulative, cumulativeMax)
+		if prevX >= 0 {
+			thickLine(img, prevX, prevY, x, y, colorCumulative)
+		}
+		fillRect(img, image.Rect(x-2, y-2, x+3, y+3), colorCumulative)
+		prevX, prevY = x, y
+	}
+
+	// 坐标轴
+	hLine(img, plot.Min.X, plot.Max.X, plot.Max.Y, colorAxis)
+	vLine(img, plot.Min.X, plot.Min.Y, plot.Max.Y, colorAxis)
+	vLine(img, plot.Max.X, plot.Min.Y, plot.Max.Y, colorAxis)
+
+	return img
+}
+
+// niceCeil 将最大值向上取整为 1, 2, 5 乘以 10 的幂, 使刻度更易读.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 0
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*exp >= v {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r.Canon(), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func hLine(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func vLine(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// thickLine 绘制 2 像素宽的线段.
+func thickLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	steps := maxInt(absInt(x1-x0), absInt(y1-y0))
+	if steps == 0 {
+		img.Set(x0, y0, c)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		img.Set(x, y, c)
+		img.Set(x+1, y, c)
+		img.Set(x, y+1, c)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package chart
+
+import (
+	"image"
+	"image/color"
+)
+
+// 3x5 点阵字体, 放大 fontScale 倍绘制. 只包含刻度和日期需要的字符.
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+	fontScale   = 2
+	glyphGap    = 1
+
+	textHeight = glyphHeight * fontScale
+)
+
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	'-': {"...", "...", "###", "...", "..."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	' ': {"...", "...", "...", "...", "..."},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'G': {"###", "#..", "#.#", "#.#", "###"},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'P': {"##.", "#.#", "##.", "#..", "#.."},
+	'i': {".#.", "...", ".#.", ".#.", ".#."},
+}
+
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n <= 0 {
+		return 0
+	}
+	return n*(glyphWidth+glyphGap)*fontScale - glyphGap*fontScale
+}
+
+// drawText 从左上角 (x, y) 开始绘制文字, 不支持的字符绘制为空白.
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	for _, r := range s {
+		glyph, ok := glyphs[r]
+		if ok {
+			for row, line := range glyph {
+				for col, pixel := range line {
+					if pixel != '#' {
+						continue
+					}
+					for dy := 0; dy < fontScale; dy++ {
+						for dx := 0; dx < fontScale; dx++ {
+							img.Set(x+col*fontScale+dx, y+row*fontScale+dy, c)
+						}
+					}
+				}
+			}
+		}
+		x += (glyphWidth + glyphGap) * fontScale
+	}
+}
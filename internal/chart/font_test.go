@@ -0,0 +1,62 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package chart
+
+import (
+	"fmt"
+	"testing"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+// TestGlyphs 检查图表可能绘制的所有字符都有对应的字形: 纵轴刻度为格式化后的流量, 横轴为日期.
+func TestGlyphs(t *testing.T) {
+	var texts []string
+	for _, system := range []bytesize.System{bytesize.Binary, bytesize.Decimal} {
+		for _, size := range []bytesize.Size{
+			0, 1, 999,
+			bytesize.KiB, bytesize.MiB, bytesize.GiB, bytesize.TiB, bytesize.PiB,
+			bytesize.KB, bytesize.MB, bytesize.GB, bytesize.TB, bytesize.PB,
+			1234567890123, -bytesize.GiB,
+		} {
+			texts = append(texts, size.Format(system))
+		}
+	}
+	for day := 1; day <= 31; day++ {
+		texts = append(texts, fmt.Sprintf("%02d", day))
+	}
+
+	for _, text := range texts {
+		for _, r := range text {
+			if _, ok := glyphs[r]; !ok {
+				t.Errorf("no glyph for %q in %q", r, text)
+			}
+		}
+	}
+}
+
+func TestGlyphSize(t *testing.T) {
+	for r, glyph := range glyphs {
+		for _, line := range glyph {
+			if len(line) != glyphWidth {
+				t.Errorf("glyph %q has a line %q of width %d, want %d", r, line, len(line), glyphWidth)
+			}
+		}
+	}
+}
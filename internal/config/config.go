@@ -25,22 +25,92 @@ import (
 // Config stores app configurations.
 type Config struct {
 	Telegram struct {
-		BotToken         string `toml:"bot-token"`
-		AllowedRecipient string `toml:"allowed-recipient"`
+		BotToken         string  `toml:"bot-token"`
+		AllowedRecipient string  `toml:"allowed-recipient"`
+		Admins           []int64 `toml:"admins"`
 	} `toml:"telegram"`
 
 	DlerCloud struct {
-		Email    string `toml:"email"`
-		Password string `toml:"password"`
+		Email          string `toml:"email"`
+		Password       string `toml:"password"`
+		AutoCheckin    string `toml:"auto-checkin"`
+		SubDeleteAfter int    `toml:"sub-delete-after"`
+		ResetDay       int    `toml:"reset-day"`
 	} `toml:"dler-cloud"`
 
+	Subscriptions struct {
+		UserAgent string `toml:"user-agent"`
+		URLs      map[string]struct {
+			URL string `toml:"url"`
+		} `toml:"urls"`
+	} `toml:"subscriptions"`
+
 	Vultr struct {
-		Enabled   bool   `toml:"enabled"`
-		APIKey    string `toml:"api-key"`
-		Instances map[string]struct {
-			ID string `toml:"id"`
+		Enabled         bool     `toml:"enabled"`
+		APIKey          string   `toml:"api-key"`
+		Timezone        string   `toml:"timezone"`
+		CycleStartDay   int      `toml:"cycle-start-day"`
+		PerPage         int      `toml:"per-page"`
+		GuardDryRun     bool     `toml:"guard-dry-run"`
+		AutoDiscover    bool     `toml:"auto-discover"`
+		DiscoverTags    []string `toml:"discover-tags"`
+		DiscoverRegions []string `toml:"discover-regions"`
+		Pooled          bool     `toml:"pooled"`
+		Instances       map[string]struct {
+			ID      string `toml:"id"`
+			Exclude bool   `toml:"exclude"`
+			Counted string `toml:"counted"`
+
+			Guard          bool    `toml:"guard"`
+			GuardPercent   float64 `toml:"guard-percent"`
+			GuardProjected bool    `toml:"guard-projected"`
+			GuardGrace     int     `toml:"guard-grace"`
+
+			SnapshotSchedule  string `toml:"snapshot-schedule"`
+			SnapshotRetention int    `toml:"snapshot-retention"`
 		} `toml:"instances"`
+
+		DDNSInterval int `toml:"ddns-interval"`
+		DDNS         []struct {
+			Instance string `toml:"instance"`
+			Domain   string `toml:"domain"`
+			Name     string `toml:"name"`
+			TTL      int    `toml:"ttl"`
+			IPv6     bool   `toml:"ipv6"`
+		} `toml:"ddns"`
 	} `toml:"vultr"`
+
+	Reminder struct {
+		Enabled    bool  `toml:"enabled"`
+		Interval   int   `toml:"interval"`
+		ExpiryDays []int `toml:"expiry-days"`
+	} `toml:"reminder"`
+
+	Alert struct {
+		Interval int `toml:"interval"`
+		Rules    []struct {
+			Provider    string  `toml:"provider"`
+			Instance    string  `toml:"instance"`
+			Remaining   string  `toml:"remaining"`
+			UsedPercent float64 `toml:"used-percent"`
+			Projected   bool    `toml:"projected"`
+		} `toml:"rules"`
+	} `toml:"alert"`
+
+	Reports []struct {
+		Schedule string   `toml:"schedule"`
+		Timezone string   `toml:"timezone"`
+		Chats    []string `toml:"chats"`
+	} `toml:"reports"`
+
+	Display struct {
+		SizeUnits string `toml:"size-units"`
+		Timezone  string `toml:"timezone"`
+	} `toml:"display"`
+
+	State struct {
+		Path string `toml:"path"`
+	} `toml:"state"`
 }
 
 // FromFile parse configs from file.
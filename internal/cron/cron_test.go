@@ -0,0 +1,247 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// bits 返回包含各取值的位集合.
+func bits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+// span 返回 [lo, hi] 中按 step 取值的位集合.
+func span(lo, hi, step int) uint64 {
+	var b uint64
+	for v := lo; v <= hi; v += step {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Schedule
+		wantErr bool
+	}{
+		{
+			spec: "* * * * *",
+			want: Schedule{minute: span(0, 59, 1), hour: span(0, 23, 1), dom: span(1, 31, 1), month: span(1, 12, 1), dow: span(0, 7, 1), domStar: true, dowStar: true},
+		},
+		{
+			spec: "30 9 * * *",
+			want: Schedule{minute: bits(30), hour: bits(9), dom: span(1, 31, 1), month: span(1, 12, 1), dow: span(0, 7, 1), domStar: true, dowStar: true},
+		},
+
+		// 范围, 列表和步长
+		{
+			spec: "0-10 9-17 1,15 1-6 1-5",
+			want: Schedule{minute: span(0, 10, 1), hour: span(9, 17, 1), dom: bits(1, 15), month: span(1, 6, 1), dow: span(1, 5, 1)},
+		},
+		{
+			spec: "*/15 0-12/4 */2 * *",
+			want: Schedule{minute: bits(0, 15, 30, 45), hour: bits(0, 4, 8, 12), dom: span(1, 31, 2), month: span(1, 12, 1), dow: span(0, 7, 1), domStar: true, dowStar: true},
+		},
+		{
+			spec: "5/20 * 1,10-12 * *",
+			want: Schedule{minute: bits(5, 25, 45), hour: span(0, 23, 1), dom: bits(1, 10, 11, 12), month: span(1, 12, 1), dow: span(0, 7, 1), dowStar: true},
+		},
+
+		// 周日可以写作 0 或 7
+		{
+			spec: "0 0 * * 7",
+			want: Schedule{minute: bits(0), hour: bits(0), dom: span(1, 31, 1), month: span(1, 12, 1), dow: bits(0, 7), domStar: true},
+		},
+
+		// 名称
+		{
+			spec: "0 0 * jan,JUN-Aug mon-fri",
+			want: Schedule{minute: bits(0), hour: bits(0), dom: span(1, 31, 1), month: bits(1, 6, 7, 8), dow: span(1, 5, 1), domStar: true},
+		},
+		{
+			spec: "0 0 * DEC SUN",
+			want: Schedule{minute: bits(0), hour: bits(0), dom: span(1, 31, 1), month: bits(12), dow: bits(0), domStar: true},
+		},
+
+		// 错误的格式
+		{spec: "", wantErr: true},
+		{spec: "* * * *", wantErr: true},
+		{spec: "* * * * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* 24 * * *", wantErr: true},
+		{spec: "* * 0 * *", wantErr: true},
+		{spec: "* * * 13 *", wantErr: true},
+		{spec: "* * * * 8", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "*/x * * * *", wantErr: true},
+		{spec: "a * * * *", wantErr: true},
+		{spec: "1- * * * *", wantErr: true},
+		{spec: "* * * * MON-", wantErr: true},
+		{spec: "* * * FOO *", wantErr: true},
+		{spec: "* * MON * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	cst := time.FixedZone("CST", 8*60*60)
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want time.Time
+	}{
+		{
+			name: "同一天",
+			spec: "30 9 * * *",
+			t:    date(2022, 5, 10, 8, 0),
+			want: date(2022, 5, 10, 9, 30),
+		},
+		{
+			name: "不含 t 本身",
+			spec: "30 9 * * *",
+			t:    date(2022, 5, 10, 9, 30),
+			want: date(2022, 5, 11, 9, 30),
+		},
+		{
+			name: "忽略秒",
+			spec: "* * * * *",
+			t:    date(2022, 5, 10, 9, 30).Add(45 * time.Second),
+			want: date(2022, 5, 10, 9, 31),
+		},
+		{
+			name: "跨月",
+			spec: "0 0 1 * *",
+			t:    date(2022, 1, 31, 12, 0),
+			want: date(2022, 2, 1, 0, 0),
+		},
+		{
+			name: "跨年",
+			spec: "0 0 1 1 *",
+			t:    date(2022, 12, 31, 23, 59),
+			want: date(2023, 1, 1, 0, 0),
+		},
+		{
+			name: "31 日跳过较短的月份",
+			spec: "0 0 31 * *",
+			t:    date(2022, 4, 1, 0, 0),
+			want: date(2022, 5, 31, 0, 0),
+		},
+		{
+			name: "2 月 29 日",
+			spec: "0 0 29 2 *",
+			t:    date(2022, 3, 1, 0, 0),
+			want: date(2024, 2, 29, 0, 0),
+		},
+		{
+			name: "不存在的日期",
+			spec: "0 0 30 2 *",
+			t:    date(2022, 1, 1, 0, 0),
+			want: time.Time{},
+		},
+		{
+			name: "周",
+			spec: "0 9 * * MON",
+			t:    date(2022, 5, 10, 0, 0), // 周二
+			want: date(2022, 5, 16, 9, 0),
+		},
+		{
+			name: "周日写作 7",
+			spec: "0 9 * * 7",
+			t:    date(2022, 5, 10, 0, 0),
+			want: date(2022, 5, 15, 9, 0),
+		},
+		{
+			name: "日和周同时受限时满足其一即可, 周先满足",
+			spec: "0 0 20 * 1",
+			t:    date(2022, 5, 10, 0, 0),
+			want: date(2022, 5, 16, 0, 0),
+		},
+		{
+			name: "日和周同时受限时满足其一即可, 日先满足",
+			spec: "0 0 12 * 1",
+			t:    date(2022, 5, 10, 0, 0),
+			want: date(2022, 5, 12, 0, 0),
+		},
+		{
+			name: "以 * 开头的日不受限, 只按周",
+			spec: "0 0 */2 * 1",
+			t:    date(2022, 5, 10, 0, 0),
+			want: date(2022, 5, 16, 0, 0),
+		},
+		{
+			name: "以 * 开头的周不受限, 只按日",
+			spec: "0 0 20 * */2",
+			t:    date(2022, 5, 10, 0, 0),
+			want: date(2022, 5, 20, 0, 0),
+		},
+		{
+			name: "步长",
+			spec: "*/15 * * * *",
+			t:    date(2022, 5, 10, 9, 46),
+			want: date(2022, 5, 10, 10, 0),
+		},
+		{
+			name: "使用 t 所在的时区",
+			spec: "0 9 * * *",
+			t:    time.Date(2022, 5, 10, 10, 0, 0, 0, cst),
+			want: time.Date(2022, 5, 11, 9, 0, 0, 0, cst),
+		},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("%s: Parse(%q) error: %v", tt.name, tt.spec, err)
+			continue
+		}
+		got := s.Next(tt.t)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%v) of %q = %v, want %v", tt.name, tt.t, tt.spec, got, tt.want)
+		}
+	}
+}
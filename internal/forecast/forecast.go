@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package forecast
+
+import (
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+// 估算日均用量时使用的最近天数.
+const recentDays = 7
+
+// Forecast 用量预测.
+type Forecast struct {
+	// DailyRate 估算的日均用量.
+	DailyRate bytesize.Size
+	// Projected 预计周期末的总用量, 周期结束时间未知时为 0.
+	Projected bytesize.Size
+	// RunsOutAt 预计用尽的时间, 在周期内不会用尽时为零值.
+	RunsOutAt time.Time
+}
+
+// Project 根据最近的日用量估算周期末的用量和用尽时间.
+//
+// daily 为按时间顺序排列的完整自然日用量, 只使用最近 7 天, 越近的日期权重越大,
+// 以便更快反映用量的变化. end 为周期结束时间, 为零值时只估算用尽时间.
+// daily 为空时返回 nil.
+func Project(used bytesize.Size, total bytesize.Size, daily []bytesize.Size, now time.Time, end time.Time) *Forecast {
+	if len(daily) <= 0 {
+		return nil
+	}
+	if len(daily) > recentDays {
+		daily = daily[len(daily)-recentDays:]
+	}
+
+	var sum, weights float64
+	for i, d := range daily {
+		w := float64(i + 1)
+		sum += float64(d) * w
+		weights += w
+	}
+	rate := sum / weights
+
+	f := &Forecast{DailyRate: bytesize.Size(rate)}
+	if !end.IsZero() && end.After(now) {
+		f.Projected = used + bytesize.Size(rate*end.Sub(now).Hours()/24)
+	} else if !end.IsZero() {
+		f.Projected = used
+	}
+
+	if rate > 0 && total > 0 {
+		remaining := total - used
+		runsOut := now
+		if remaining > 0 {
+			runsOut = now.Add(time.Duration(float64(remaining) / rate * float64(24*time.Hour)))
+		}
+		if end.IsZero() || runsOut.Before(end) {
+			f.RunsOutAt = runsOut
+		}
+	}
+	return f
+}
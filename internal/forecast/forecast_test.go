@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+func TestProject(t *testing.T) {
+	const GiB = bytesize.GiB
+	now := time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC)
+	days := func(n float64) time.Time {
+		return now.Add(time.Duration(n * float64(24*time.Hour)))
+	}
+
+	tests := []struct {
+		name  string
+		used  bytesize.Size
+		total bytesize.Size
+		daily []bytesize.Size
+		end   time.Time
+		want  *Forecast
+	}{
+		{
+			name:  "没有历史数据",
+			used:  5 * GiB,
+			total: 100 * GiB,
+			end:   days(10),
+			want:  nil,
+		},
+		{
+			name:  "只有一天",
+			used:  5 * GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{10 * GiB},
+			end:   days(10),
+			want:  &Forecast{DailyRate: 10 * GiB, Projected: 105 * GiB, RunsOutAt: days(9.5)},
+		},
+		{
+			name:  "越近的日期权重越大",
+			used:  10 * GiB,
+			total: 1000 * GiB,
+			daily: []bytesize.Size{6 * GiB, 6 * GiB, 12 * GiB},
+			end:   days(10),
+			want:  &Forecast{DailyRate: 9 * GiB, Projected: 100 * GiB},
+		},
+		{
+			name:  "只使用最近 7 天",
+			used:  10 * GiB,
+			total: 1000 * GiB,
+			daily: []bytesize.Size{100 * GiB, 100 * GiB, 100 * GiB, GiB, GiB, GiB, GiB, GiB, GiB, GiB},
+			end:   days(10),
+			want:  &Forecast{DailyRate: GiB, Projected: 20 * GiB},
+		},
+		{
+			name:  "周期中流量重置, 按重置后的已用流量估算",
+			used:  GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{10 * GiB, 10 * GiB},
+			end:   days(5),
+			want:  &Forecast{DailyRate: 10 * GiB, Projected: 51 * GiB},
+		},
+		{
+			name:  "已经超出额度",
+			used:  110 * GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{10 * GiB},
+			end:   days(5),
+			want:  &Forecast{DailyRate: 10 * GiB, Projected: 160 * GiB, RunsOutAt: now},
+		},
+		{
+			name:  "没有用量",
+			used:  10 * GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{0, 0},
+			end:   days(5),
+			want:  &Forecast{Projected: 10 * GiB},
+		},
+		{
+			name:  "周期结束时间未知",
+			used:  50 * GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{10 * GiB},
+			want:  &Forecast{DailyRate: 10 * GiB, RunsOutAt: days(5)},
+		},
+		{
+			name:  "周期在最近一次数据之前结束",
+			used:  50 * GiB,
+			total: 100 * GiB,
+			daily: []bytesize.Size{10 * GiB},
+			end:   days(-1),
+			want:  &Forecast{DailyRate: 10 * GiB, Projected: 50 * GiB},
+		},
+		{
+			name:  "没有额度",
+			used:  50 * GiB,
+			daily: []bytesize.Size{10 * GiB},
+			end:   days(5),
+			want:  &Forecast{DailyRate: 10 * GiB, Projected: 100 * GiB},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Project(tt.used, tt.total, tt.daily, now, tt.end)
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("%s: Project() = %+v, want nil", tt.name, *got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: Project() = nil, want %+v", tt.name, *tt.want)
+			continue
+		}
+		if got.DailyRate != tt.want.DailyRate || got.Projected != tt.want.Projected || !got.RunsOutAt.Equal(tt.want.RunsOutAt) {
+			t.Errorf("%s: Project() = %+v, want %+v", tt.name, *got, *tt.want)
+		}
+	}
+}
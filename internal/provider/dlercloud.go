@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package provider
+
+import (
+	"context"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/dler"
+	"dlercloud-telegarm-bot/internal/billing"
+)
+
+// DlerCloudOptions Dler Cloud 服务的配置.
+type DlerCloudOptions struct {
+	Location *time.Location
+
+	// ResetDay 每月重置流量的日期. 为 0 时按套餐到期时间的日期计算.
+	ResetDay int
+}
+
+// NewDlerCloud 返回 Dler Cloud 服务.
+func NewDlerCloud(client *dler.Client, opts DlerCloudOptions) Provider {
+	return &dlerCloud{client: client, opts: opts}
+}
+
+type dlerCloud struct {
+	client *dler.Client
+	opts   DlerCloudOptions
+}
+
+func (p *dlerCloud) Name() string {
+	return "dler-cloud"
+}
+
+func (p *dlerCloud) Title() string {
+	return "Dler Cloud"
+}
+
+func (p *dlerCloud) FetchUsage(ctx context.Context) []*Usage {
+	usage := &Usage{Provider: p.Name(), Name: p.Title()}
+
+	info, err := p.client.GetUserInfo(ctx)
+	if err != nil {
+		usage.Err = err
+		return []*Usage{usage}
+	}
+	usage.Used = info.Used
+	usage.Unused = info.Unused
+	usage.Total = info.Used + info.Unused
+	if day := p.resetDay(info); day > 0 {
+		usage.ResetAt = billing.CycleAt(time.Now(), p.opts.Location, day).End
+	}
+	return []*Usage{usage}
+}
+
+// resetDay 返回每月重置流量的日期, 未知时返回 0.
+// 未配置时认为流量在套餐到期日对应的每月同一天重置.
+func (p *dlerCloud) resetDay(info *dler.UserInfo) int {
+	if p.opts.ResetDay > 0 {
+		return p.opts.ResetDay
+	}
+	if expiry, ok := info.PlanExpiry(p.opts.Location); ok {
+		return expiry.Day()
+	}
+	return 0
+}
+
+func (p *dlerCloud) Health(ctx context.Context) error {
+	_, err := p.client.GetUserInfo(ctx)
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package provider
+
+import (
+	"context"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/forecast"
+)
+
+// Provider 流量服务. 一个服务可以包含多个对象, 例如 Vultr 的多个实例.
+type Provider interface {
+	// Name 返回服务在配置文件中的名称, 例如 "dler-cloud".
+	Name() string
+	// Title 返回服务的显示名称, 例如 "Dler Cloud".
+	Title() string
+	// FetchUsage 查询所有对象的流量使用情况. 单个对象查询失败时设置其 Err, 不影响其他对象.
+	FetchUsage(ctx context.Context) []*Usage
+	// Health 检查服务是否可用.
+	Health(ctx context.Context) error
+}
+
+// Usage 一个对象的流量使用情况.
+type Usage struct {
+	Provider string // 所属服务的名称
+	Name     string // 对象的显示名称
+
+	Used   bytesize.Size
+	Unused bytesize.Size
+	Total  bytesize.Size
+
+	// Pool 与其他对象共享额度时为提供额度的对象名称, 此时 Total 和 Unused 为 0,
+	// Used 为该对象贡献的用量.
+	Pool string
+
+	// ResetAt 流量下次重置的时间, 未知时为零值.
+	ResetAt time.Time
+	// ExpireAt 套餐到期时间, 未知或不过期时为零值.
+	ExpireAt time.Time
+
+	// Daily 本周期内按时间顺序排列的完整自然日用量, 服务不提供时为空.
+	Daily []bytesize.Size
+	// Forecast 用量预测, 无法预测时为空. 服务可以直接给出预测.
+	Forecast *forecast.Forecast
+
+	// Err 查询失败的原因.
+	Err error
+}
+
+// Key 返回对象在所有服务中唯一的标识.
+func (u *Usage) Key() string {
+	return u.Provider + "/" + u.Name
+}
+
+// Registry 按配置名称注册的服务, 保持注册顺序.
+type Registry struct {
+	providers []Provider
+	byName    map[string]Provider
+}
+
+// NewRegistry 返回空的 Registry.
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]Provider)}
+}
+
+// Register 注册服务. 同名服务会覆盖之前注册的服务.
+func (r *Registry) Register(p Provider) {
+	if _, exist := r.byName[p.Name()]; exist {
+		for i, old := range r.providers {
+			if old.Name() == p.Name() {
+				r.providers[i] = p
+			}
+		}
+	} else {
+		r.providers = append(r.providers, p)
+	}
+	r.byName[p.Name()] = p
+}
+
+// Get 返回指定名称的服务.
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.byName[name]
+	return p, ok
+}
+
+// Providers 按注册顺序返回所有服务.
+func (r *Registry) Providers() []Provider {
+	return r.providers
+}
+
+// FetchUsage 并发查询所有服务的流量使用情况, 按注册顺序返回.
+func (r *Registry) FetchUsage(ctx context.Context) []*Usage {
+	results := make([][]*Usage, len(r.providers))
+	done := make(chan struct{}, len(r.providers))
+	for i, p := range r.providers {
+		go func(i int, p Provider) {
+			defer func() { done <- struct{}{} }()
+			results[i] = p.FetchUsage(ctx)
+		}(i, p)
+	}
+	for range r.providers {
+		<-done
+	}
+
+	var ret []*Usage
+	for _, usages := range results {
+		ret = append(ret, usages...)
+	}
+	return ret
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"dlercloud-telegarm-bot/internal/api/subscription"
+)
+
+// SubscriptionURL 需要查询的订阅链接.
+type SubscriptionURL struct {
+	Name string
+	URL  string
+}
+
+// NewSubscriptions 返回通过 subscription-userinfo 响应头查询流量的服务, 每个订阅链接作为一个对象.
+func NewSubscriptions(client *subscription.Client, urls []*SubscriptionURL) Provider {
+	return &subscriptions{client: client, urls: urls}
+}
+
+type subscriptions struct {
+	client *subscription.Client
+	urls   []*SubscriptionURL
+}
+
+func (p *subscriptions) Name() string {
+	return "subscriptions"
+}
+
+func (p *subscriptions) Title() string {
+	return "订阅"
+}
+
+func (p *subscriptions) FetchUsage(ctx context.Context) []*Usage {
+	ret := make([]*Usage, len(p.urls))
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxConcurrentQueries)
+	)
+	for i, u := range p.urls {
+		ret[i] = &Usage{Provider: p.Name(), Name: u.Name}
+
+		wg.Add(1)
+		go func(usage *Usage, url string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			info, err := p.client.GetUserinfo(ctx, url)
+			if err != nil {
+				usage.Err = err
+				return
+			}
+			usage.Used = info.Used()
+			usage.Total = info.Total
+			usage.Unused = info.Total - info.Used()
+			usage.ExpireAt = info.Expire
+		}(ret[i], u.URL)
+	}
+	wg.Wait()
+
+	return ret
+}
+
+func (p *subscriptions) Health(ctx context.Context) error {
+	for _, usage := range p.FetchUsage(ctx) {
+		if usage.Err != nil {
+			return usage.Err
+		}
+	}
+	return nil
+}
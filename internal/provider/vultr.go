@@ -0,0 +1,447 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/api/vultr"
+	"dlercloud-telegarm-bot/internal/billing"
+	"dlercloud-telegarm-bot/internal/bytesize"
+	"dlercloud-telegarm-bot/internal/forecast"
+)
+
+// 同时进行的查询请求数上限.
+const maxConcurrentQueries = 4
+
+// VultrInstance 需要查询的 Vultr 实例.
+type VultrInstance struct {
+	Name       string
+	InstanceID string
+	Exclude    bool      // 自动发现时排除该实例
+	Counted    Direction // 计入流量额度的方向
+
+	// Instance 实例详情, 仅在 ResolveInstances 的返回值中有效.
+	Instance *vultr.Instance
+}
+
+// Direction 计入流量额度的带宽方向.
+type Direction string
+
+const (
+	DirectionBoth     Direction = "both"
+	DirectionOutgoing Direction = "outgoing"
+	DirectionIncoming Direction = "incoming"
+)
+
+// ParseDirection 解析带宽方向, 空字符串为 DirectionBoth.
+func ParseDirection(s string) (Direction, error) {
+	switch d := Direction(s); d {
+	case "":
+		return DirectionBoth, nil
+	case DirectionBoth, DirectionOutgoing, DirectionIncoming:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown direction %q", s)
+	}
+}
+
+// VultrOptions Vultr 服务的配置.
+type VultrOptions struct {
+	Instances     []*VultrInstance
+	Location      *time.Location // Vultr 计费使用的时区
+	CycleStartDay int
+
+	// AutoDiscover 自动查询账户下的所有实例, 并以实例标签命名.
+	// Tags 和 Regions 不为空时只包含带有其中任一标签和位于其中任一地区的实例.
+	AutoDiscover bool
+	Tags         []string
+	Regions      []string
+
+	// Pooled 账户内的实例共享带宽额度. 此时计费周期为自然月, 实例只统计其贡献的出站流量,
+	// 额度和剩余流量由名为 VultrPoolName 的对象给出.
+	Pooled bool
+}
+
+// VultrPoolName 共享带宽模式下账户对象的名称.
+const VultrPoolName = "账户"
+
+// NewVultr 返回 Vultr 服务.
+func NewVultr(client *vultr.Client, opts VultrOptions) *Vultr {
+	return &Vultr{client: client, opts: opts, instances: opts.Instances}
+}
+
+// Vultr Vultr 服务, 每个实例作为一个对象.
+type Vultr struct {
+	client *vultr.Client
+	opts   VultrOptions
+
+	mu        sync.RWMutex
+	instances []*VultrInstance // 配置中的实例, 可通过 SetInstanceID 修改
+}
+
+func (p *Vultr) Name() string {
+	return "vultr"
+}
+
+func (p *Vultr) Title() string {
+	return "Vultr"
+}
+
+// ResolveInstances 返回需要查询的实例. 配置中的实例名称优先于自动发现的名称.
+func (p *Vultr) ResolveInstances(ctx context.Context) ([]*VultrInstance, error) {
+	instances, err := p.client.GetInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query all instances: %+v", err)
+	}
+	return p.resolve(instances), nil
+}
+
+func (p *Vultr) resolve(instances []*vultr.Instance) []*VultrInstance {
+	byID := make(map[string]*vultr.Instance, len(instances))
+	for _, inst := range instances {
+		byID[inst.ID] = inst
+	}
+
+	configuredInstances := p.configuredInstances()
+	configured := make(map[string]bool, len(configuredInstances))
+	ret := make([]*VultrInstance, 0, len(configuredInstances))
+	for _, inst := range configuredInstances {
+		configured[inst.InstanceID] = true
+		if inst.Exclude {
+			continue
+		}
+		ret = append(ret, &VultrInstance{
+			Name:       inst.Name,
+			InstanceID: inst.InstanceID,
+			Counted:    inst.Counted,
+			Instance:   byID[inst.InstanceID],
+		})
+	}
+	if !p.opts.AutoDiscover {
+		return ret
+	}
+
+	names := make(map[string]bool, len(instances))
+	for _, inst := range ret {
+		names[inst.Name] = true
+	}
+
+	var discovered []*VultrInstance
+	for _, inst := range instances {
+		if configured[inst.ID] || !p.matchFilters(inst) {
+			continue
+		}
+
+		name := inst.Label
+		if len(name) <= 0 {
+			name = inst.ID
+		}
+		// 标签重复时附加实例 ID 前缀以区分
+		if names[name] {
+			name = fmt.Sprintf("%s-%.8s", name, inst.ID)
+		}
+		names[name] = true
+
+		discovered = append(discovered, &VultrInstance{
+			Name:       name,
+			InstanceID: inst.ID,
+			Counted:    DirectionBoth,
+			Instance:   inst,
+		})
+	}
+	sort.Slice(discovered, func(i, j int) bool {
+		return discovered[i].Name < discovered[j].Name
+	})
+
+	return append(ret, discovered...)
+}
+
+func (p *Vultr) configuredInstances() []*VultrInstance {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.instances
+}
+
+// SetInstanceID 将名为 name 的实例指向 instanceID, 例如实例重建之后.
+// 实例不在配置中时 (自动发现的实例) 将其加入配置.
+func (p *Vultr) SetInstanceID(name string, instanceID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 复制后修改, 不影响正在使用旧列表的查询
+	instances := make([]*VultrInstance, 0, len(p.instances)+1)
+	found := false
+	for _, inst := range p.instances {
+		if inst.Name == name {
+			copied := *inst
+			copied.InstanceID = instanceID
+			inst, found = &copied, true
+		}
+		instances = append(instances, inst)
+	}
+	if !found {
+		instances = append(instances, &VultrInstance{Name: name, InstanceID: instanceID, Counted: DirectionBoth})
+	}
+	p.instances = instances
+}
+
+func (p *Vultr) matchFilters(inst *vultr.Instance) bool {
+	if len(p.opts.Regions) > 0 && !contains(p.opts.Regions, inst.Region) {
+		return false
+	}
+	if len(p.opts.Tags) > 0 {
+		for _, tag := range p.opts.Tags {
+			if inst.HasTag(tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Cycle 返回 now 所在的计费周期.
+func (p *Vultr) Cycle(now time.Time) billing.Cycle {
+	if p.opts.Pooled {
+		return billing.CycleAt(now, p.opts.Location, 1)
+	}
+	return billing.CycleAt(now, p.opts.Location, p.opts.CycleStartDay)
+}
+
+// Pooled 返回是否为共享带宽模式.
+func (p *Vultr) Pooled() bool {
+	return p.opts.Pooled
+}
+
+// AccountBandwidth 查询账户共享带宽的使用情况.
+func (p *Vultr) AccountBandwidth(ctx context.Context) (*vultr.AccountBandwidth, error) {
+	return p.client.GetAccountBandwidth(ctx)
+}
+
+// FetchUsage 并发查询所有实例的带宽使用情况, 返回结果与 ResolveInstances 顺序一致.
+func (p *Vultr) FetchUsage(ctx context.Context) []*Usage {
+	return p.fetchUsage(ctx, func() ([]*VultrInstance, error) {
+		return p.ResolveInstances(ctx)
+	})
+}
+
+// FetchInstancesUsage 查询已由 ResolveInstances 得到的实例的带宽使用情况, 不再重复查询实例列表.
+func (p *Vultr) FetchInstancesUsage(ctx context.Context, instances []*VultrInstance) []*Usage {
+	return p.fetchUsage(ctx, func() ([]*VultrInstance, error) {
+		return instances, nil
+	})
+}
+
+// fetchUsage 查询 resolve 返回的实例的带宽使用情况. 共享带宽模式下同时查询账户的额度.
+func (p *Vultr) fetchUsage(ctx context.Context, resolve func() ([]*VultrInstance, error)) []*Usage {
+	// Vultr 按自身时区 (UTC) 的自然日统计带宽
+	cycle := p.Cycle(time.Now())
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxConcurrentQueries)
+	)
+
+	var pool *Usage
+	if p.opts.Pooled {
+		pool = &Usage{Provider: p.Name(), Name: VultrPoolName, ResetAt: cycle.End}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.fetchPoolUsage(ctx, pool)
+		}()
+	}
+
+	// 查询所有实例的流量总额
+	targets, err := resolve()
+	if err != nil {
+		wg.Wait()
+
+		// 无法自动发现实例时, 至少为配置中的实例返回错误
+		configured := p.configuredInstances()
+		ret := make([]*Usage, 0, len(configured)+1)
+		if pool != nil {
+			ret = append(ret, pool)
+		}
+		failed := 0
+		for _, inst := range configured {
+			if !inst.Exclude {
+				ret = append(ret, &Usage{Provider: p.Name(), Name: inst.Name, Err: err})
+				failed++
+			}
+		}
+		// 没有配置实例时返回服务本身的错误, 避免查询失败时结果为空
+		if failed <= 0 {
+			ret = append(ret, &Usage{Provider: p.Name(), Name: p.Title(), Err: err})
+		}
+		return ret
+	}
+
+	ret := make([]*Usage, len(targets))
+	for i, inst := range targets {
+		ret[i] = &Usage{Provider: p.Name(), Name: inst.Name, ResetAt: cycle.End}
+		if pool != nil {
+			ret[i].Pool = pool.Name
+		}
+	}
+
+	for i, inst := range targets {
+		if inst.Instance == nil {
+			ret[i].Err = fmt.Errorf("vultr instance %s not found in your account", inst.InstanceID)
+			continue
+		}
+		total := inst.Instance.AllowedBandwidth()
+		counted := inst.Counted
+		if pool != nil {
+			// 共享额度由账户给出, 实例只统计计入额度的出站流量
+			total, counted = 0, DirectionOutgoing
+		}
+
+		wg.Add(1)
+		go func(usage *Usage, instanceID string, counted Direction) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			daily, err := p.DailyBandwidth(ctx, instanceID, cycle)
+			if err != nil {
+				usage.Err = err
+				return
+			}
+
+			// 今天的数据不完整, 不计入每日用量序列
+			for i, d := range daily {
+				usage.Used += d.Counted(counted)
+				if i < len(daily)-1 {
+					usage.Daily = append(usage.Daily, d.Counted(counted))
+				}
+			}
+			if total > 0 {
+				usage.Unused = total - usage.Used
+				usage.Total = total
+			}
+		}(ret[i], inst.InstanceID, counted)
+	}
+	wg.Wait()
+
+	if pool != nil {
+		ret = append([]*Usage{pool}, ret...)
+	}
+	return ret
+}
+
+// fetchPoolUsage 查询账户共享带宽, 并使用 Vultr 给出的本月预计用量作为预测.
+func (p *Vultr) fetchPoolUsage(ctx context.Context, pool *Usage) {
+	bandwidth, err := p.client.GetAccountBandwidth(ctx)
+	if err != nil {
+		pool.Err = err
+		return
+	}
+
+	current := &bandwidth.CurrentMonthToDate
+	pool.Used = current.Outgoing()
+	pool.Total = bandwidth.CurrentMonthProjected.Credits()
+	pool.Unused = pool.Total - pool.Used
+
+	f := &forecast.Forecast{Projected: bandwidth.CurrentMonthProjected.Outgoing()}
+	if days := time.Since(current.Start.Time).Hours() / 24; days > 0 {
+		f.DailyRate = bytesize.Size(float64(pool.Used) / days)
+	}
+	pool.Forecast = f
+}
+
+// DailyBandwidth 一天的带宽使用情况.
+type DailyBandwidth struct {
+	Date     time.Time // Vultr 时区的零点
+	Incoming bytesize.Size
+	Outgoing bytesize.Size
+}
+
+// Total 返回双向流量之和.
+func (d *DailyBandwidth) Total() bytesize.Size {
+	return d.Incoming + d.Outgoing
+}
+
+// Counted 返回指定方向计入额度的流量.
+func (d *DailyBandwidth) Counted(dir Direction) bytesize.Size {
+	switch dir {
+	case DirectionOutgoing:
+		return d.Outgoing
+	case DirectionIncoming:
+		return d.Incoming
+	default:
+		return d.Total()
+	}
+}
+
+// DailyBandwidth 查询实例在计费周期内截至今天的每日带宽使用情况, 按日期排序, 没有数据的日期为 0.
+func (p *Vultr) DailyBandwidth(ctx context.Context, instanceID string, cycle billing.Cycle) ([]*DailyBandwidth, error) {
+	byDate, err := p.client.GetInstanceBandwidth(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return dailySeries(byDate, cycle.Start, cycle.End), nil
+}
+
+// RecentBandwidth 查询实例最近 days 天 (含今天) 的每日带宽使用情况, 按日期排序.
+// Vultr 只提供最近约 30 天的数据, 更早的日期为 0.
+func (p *Vultr) RecentBandwidth(ctx context.Context, instanceID string, days int) ([]*DailyBandwidth, error) {
+	byDate, err := p.client.GetInstanceBandwidth(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(p.opts.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, p.opts.Location)
+	return dailySeries(byDate, today.AddDate(0, 0, 1-days), today.AddDate(0, 0, 1)), nil
+}
+
+// dailySeries 返回 [start, end) 范围内截至今天的每日数据. byDate 以 "2006-01-02" 格式的日期为键.
+func dailySeries(byDate map[string]vultr.BandwidthUsage, start time.Time, end time.Time) []*DailyBandwidth {
+	var ret []*DailyBandwidth
+	now := time.Now()
+	for d := start; d.Before(end) && !d.After(now); d = d.AddDate(0, 0, 1) {
+		usage := byDate[d.Format("2006-01-02")]
+		ret = append(ret, &DailyBandwidth{
+			Date:     d,
+			Incoming: usage.IncomingBytes,
+			Outgoing: usage.OutgoingBytes,
+		})
+	}
+	return ret
+}
+
+func (p *Vultr) Health(ctx context.Context) error {
+	_, err := p.client.GetInstances(ctx)
+	return err
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2022 Beta Kuang <beta.kuang@gmail.com>
+//
+// This software is provided 'as-is', without any express or implied
+// warranty. In no event will the authors be held liable for any damages
+// arising from the use of this software.
+//
+// Permission is granted to anyone to use this software for any purpose,
+// including commercial applications, and to alter it and redistribute it
+// freely, subject to the following restrictions:
+//
+// 1. The origin of this software must not be misrepresented; you must not
+//    claim that you wrote the original software. If you use this software
+//    in a product, an acknowledgment in the product documentation would be
+//    appreciated but is not required.
+// 2. Altered source versions must be plainly marked as such, and must not be
+//    misrepresented as being the original software.
+// 3. This notice may not be removed or altered from any source distribution.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"dlercloud-telegarm-bot/internal/bytesize"
+)
+
+// Open 打开状态文件. 文件不存在时返回空状态; path 为空时状态仅保存在内存中.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if len(path) <= 0 {
+		return s, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %+v", err)
+	}
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state file: %+v", err)
+	}
+	return s, nil
+}
+
+// Store 持久化的 bot 状态.
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data Data
+}
+
+// Data 状态数据.
+type Data struct {
+	Dler struct {
+		Token     string    `json:"token,omitempty"`
+		TokenTime time.Time `json:"token_time,omitempty"`
+	} `json:"dler"`
+
+	Telegram struct {
+		LastUpdateID int `json:"last_update_id,omitempty"`
+	} `json:"telegram"`
+
+	Reminder struct {
+		PlanTime string        `json:"plan_time,omitempty"` // 已发送提醒对应的套餐到期时间
+		SentDays []int         `json:"sent_days,omitempty"` // 已发送过的到期前天数
+		LastUsed bytesize.Size `json:"last_used,omitempty"` // 上次查询到的已用流量, 用于检测流量重置
+	} `json:"reminder"`
+
+	Alert struct {
+		Rules  []*AlertRule    `json:"rules,omitempty"` // 运行时添加的规则
+		NextID int             `json:"next_id,omitempty"`
+		Firing map[string]bool `json:"firing,omitempty"` // 正在告警的规则与对象
+	} `json:"alert"`
+
+	// Guard 按实例名称保存的已触发流量保护的计费周期开始时间, 每个周期只触发一次
+	Guard map[string]time.Time `json:"guard,omitempty"`
+
+	// GuardPending 按实例名称保存的已触发、等待关机的流量保护, 重启后继续执行
+	GuardPending map[string]*GuardHalt `json:"guard_pending,omitempty"`
+
+	// Snapshots 不提供每日用量的对象每天一次的已用流量快照, 用于用量预测
+	Snapshots map[string][]Snapshot `json:"snapshots,omitempty"`
+
+	// Reports 各定时报告上次发送时的已用流量, 用于计算变化量
+	Reports map[string]map[string]bytesize.Size `json:"reports,omitempty"`
+
+	// VultrInstances 重建后各实例名称对应的实例 ID, 优先于配置文件
+	VultrInstances map[string]string `json:"vultr_instances,omitempty"`
+
+	// Rotations 按实例名称保存的进行中的实例重建, 重启后继续执行
+	Rotations map[string]*Rotation `json:"rotations,omitempty"`
+}
+
+// Rotation 实例重建的进度.
+type Rotation struct {
+	Step          string    `json:"step"`
+	FailedStep    string    `json:"failed_step,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Warnings      []string  `json:"warnings,omitempty"` // 不影响结果的失败, 例如删除旧实例失败
+	OldInstanceID string    `json:"old_instance_id"`
+	OldIP         string    `json:"old_ip,omitempty"`
+	SnapshotID    string    `json:"snapshot_id,omitempty"`
+	NewInstanceID string    `json:"new_instance_id,omitempty"`
+	NewIP         string    `json:"new_ip,omitempty"`
+	ChatID        int64     `json:"chat_id"`
+	MessageID     string    `json:"message_id"` // 显示进度的消息
+	StartedAt     time.Time `json:"started_at"`
+}
+
+// GuardHalt 等待执行的流量保护关机. 关机成功或管理员取消后才将该周期记为已触发.
+type GuardHalt struct {
+	Reason     string    `json:"reason"`
+	CycleStart time.Time `json:"cycle_start"`
+	Deadline   time.Time `json:"deadline"` // 未取消时在此时间自动关机
+}
+
+// AlertRule 流量告警规则. Remaining 与 UsedPercent 只有一个生效.
+type AlertRule struct {
+	ID          string        `json:"id"`
+	Provider    string        `json:"provider"`
+	Instance    string        `json:"instance,omitempty"` // 为空时对该服务的所有对象生效
+	Remaining   bytesize.Size `json:"remaining,omitempty"`
+	UsedPercent float64       `json:"used_percent,omitempty"`
+	Projected   bool          `json:"projected,omitempty"` // 按预计的周期末用量判断
+}
+
+// View 读取状态. fn 中不能保留 Data 的引用.
+func (s *Store) View(fn func(d *Data)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.data)
+}
+
+// Update 修改状态并写入文件.
+func (s *Store) Update(fn func(d *Data)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.data)
+	return s.save()
+}
+
+func (s *Store) save() error {
+	if len(s.path) <= 0 {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(&s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %+v", err)
+	}
+
+	// 先写入临时文件再重命名, 避免写入中断导致状态文件损坏
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %+v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %+v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %+v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to rename state file: %+v", err)
+	}
+	return nil
+}
+
+// Matches 返回规则是否适用于指定服务的对象.
+func (r *AlertRule) Matches(provider string, name string) bool {
+	return r.Provider == provider && (len(r.Instance) <= 0 || r.Instance == name)
+}
+
+// Snapshot 某一时刻的已用流量.
+type Snapshot struct {
+	Time time.Time     `json:"time"`
+	Used bytesize.Size `json:"used"`
+}